@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+var (
+	// defaultMutex guards defaultReporter and pendingMetrics.
+	defaultMutex sync.Mutex
+	// pendingMetrics holds the metrics created before a default reporter was set.
+	pendingMetrics []metric
+
+	// bindMutex serializes registrations with SetDefaultReporter: a metric must not be registered
+	// while the pending metrics are bound, it would not find a pending one of the same name.
+	// It is never acquired while holding the lock of a vector or defaultMutex.
+	bindMutex sync.Mutex
+)
+
+func getDefaultReporter() Reporter {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	return defaultReporter
+}
+
+// deferRegistration returns the default reporter if there is one by now. Otherwise the metric is
+// registered to the default registry of go-metrics and kept until SetDefaultReporter is called.
+// Then nil is returned along with the pending metric of the same name and type, which is the
+// given one if there was none.
+func deferRegistration(m metric) (Reporter, Metric) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	if defaultReporter != nil {
+		return defaultReporter, nil
+	}
+
+	log.Println("WARNING: no (default) metrics reporter set")
+	regName := m.regName()
+	for _, p := range pendingMetrics {
+		if p.regName() == regName && reflect.TypeOf(p) == reflect.TypeOf(m) {
+			return nil, p.(Metric)
+		}
+	}
+	pendingMetrics = append(pendingMetrics, m)
+
+	if err := metrics.Register(regName, m); err != nil {
+		log.Printf("default registry: metric could not be registered: %v", err)
+	}
+	return nil, m.(Metric)
+}
+
+// bindPending binds the pending metrics to the reporter and registers them unless the reporter
+// uses the default registry they are registered to already. They stay in the default registry:
+// unregistering would stop meters and timers. Must be called with bindMutex held but not defaultMutex.
+func bindPending(r Reporter, pending []metric) {
+	for _, m := range pending {
+		bind(m, r)
+		if mtrx, ok := r.Get(m.regName()); ok && mtrx == m.(Metric) {
+			continue
+		}
+		register(m, r)
+	}
+}
+
+// removePending removes the metric from the pending metrics. It returns false if it is not pending.
+func removePending(s *baseMetric) bool {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	for i, m := range pendingMetrics {
+		if isBase(m, s) {
+			pendingMetrics = append(pendingMetrics[:i:i], pendingMetrics[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// binder is implemented by all metrics through baseMetric. Vectors bind their children as well.
+type binder interface {
+	bind(r Reporter)
+}
+
+// rebinder is implemented by metrics deriving state from their tags or StatsD client.
+type rebinder interface {
+	rebind()
+}
+
+// bind sets the reporter of a metric created before there was one and applies its tags.
+func bind(m metric, r Reporter) {
+	m.(binder).bind(r)
+	if rb, ok := m.(rebinder); ok {
+		rb.rebind()
+	}
+}
+
+// register registers the metric under its name or, if taken, the next free one.
+func register(m metric, r Reporter) {
+	for {
+		err := r.Register(m.regName(), m.(Metric))
+		if _, ok := err.(metrics.DuplicateMetric); !ok {
+			return
+		}
+		m.regIncr()
+	}
+}
+
+func (s *counter) rebind() {
+	bindStatsD(s.Counter, &s.baseMetric)
+}
+
+func (s *gauge) rebind() {
+	bindStatsD(s.Gauge, &s.baseMetric)
+}
+
+func (s *gaugeFloat64) rebind() {
+	bindStatsD(s.GaugeFloat64, &s.baseMetric)
+}
+
+func (s *meter) rebind() {
+	s.bucketTags = buildBucketTags(s.buckets, s.tags)
+	bindStatsD(s.Meter, &s.baseMetric)
+}
+
+func (s *timer) rebind() {
+	s.bucketTags = buildBucketTags(s.buckets, s.tags)
+	bindStatsD(s.Timer, &s.baseMetric)
+}
+
+func (s *histogram) rebind() {
+	s.bucketTags = buildBucketTags(s.buckets, s.tags)
+	bindStatsD(s.Histogram, &s.baseMetric)
+}
+
+// bind binds the vector and the children created before it was bound. It holds the lock of
+// the vector: children are created concurrently and get the reporter of the vector.
+func (v *vec) bind(r Reporter) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// the children created before count against the cardinality limit of the new reporter
+	prev, _ := v.reporter.(*reporter)
+	if rep, _ := r.(*reporter); rep != prev {
+		prev.releaseSeries(len(v.children))
+		rep.countSeries(len(v.children))
+	}
+
+	v.baseMetric.bind(r)
+	for _, child := range v.children {
+		bind(child.(metric), r)
+	}
+	if v.overflow != nil {
+		bind(v.overflow.(metric), r)
+	}
+}
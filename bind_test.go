@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withoutDefaultReporter unsets the default reporter and returns a function restoring it.
+// The metrics registered to the default registry meanwhile are removed.
+func withoutDefaultReporter() func() {
+	prev := getDefaultReporter()
+	SetDefaultReporter(nil)
+
+	existing := make(map[string]bool)
+	metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+		existing[name] = true
+	})
+	return func() {
+		var added []string
+		metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+			if !existing[name] {
+				added = append(added, name)
+			}
+		})
+		for _, name := range added {
+			metrics.DefaultRegistry.Unregister(name)
+		}
+
+		defaultMutex.Lock()
+		defer defaultMutex.Unlock()
+		defaultReporter = prev
+		pendingMetrics = nil
+	}
+}
+
+func TestSetDefaultReporter_bindsPending(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	c := NewCounter("early", WithTags(map[string]string{"route": "/"}))
+	assert.True(t, c == NewCounter("early"))
+	assert.True(t, c == metrics.DefaultRegistry.Get("default/early.count"))
+	tm := NewTimer("early")
+	v := NewCounterVec("early", []string{"code"})
+	v.With("200").Inc(1)
+	closed := NewGauge("closed")
+	closed.(Closer).Close()
+	c.Inc(3)
+
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Tags(map[string]string{"host": "a", "route": "x"}))
+	SetDefaultReporter(rep)
+
+	assert.ElementsMatch(t, []string{"default/early.count", "default/early.timer", "default/early1.count"}, registered(rep))
+	assert.Empty(t, pendingMetrics)
+
+	pts := c.(Metric).AddPoints(nil)
+	require.Len(t, pts, 1)
+	assert.Equal(t, map[string]string{"host": "a", "route": "/"}, pts[0].Tags)
+	assert.Equal(t, int64(3), pts[0].Fields["early.count"])
+
+	for _, p := range tm.(Metric).AddPoints(nil) {
+		assert.Equal(t, "a", p.Tags["host"])
+		assert.Contains(t, p.Tags, "bucket")
+	}
+
+	pts = v.AddPoints(nil)
+	require.Len(t, pts, 1)
+	assert.Equal(t, map[string]string{"host": "a", "route": "x", "code": "200"}, pts[0].Tags)
+
+	// metrics created from now on are bound immediately
+	NewMeter("late")
+	assert.Contains(t, registered(rep), "default/late.meter")
+}
+
+func TestSetDefaultReporter_removesPending(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	closed := NewCounter("closed")
+	v := NewCounterVec("vec", []string{"code"})
+	require.Len(t, pendingMetrics, 2)
+
+	closed.(Closer).Close()
+	v.Close()
+	assert.Empty(t, pendingMetrics)
+	assert.Nil(t, metrics.DefaultRegistry.Get("default/closed.count"))
+
+	// unregistering from another reporter keeps the pending metrics
+	NewTimer("unregistered")
+	other := NewReporter("", "", Registry(metrics.NewRegistry()))
+	other.(Unregisterer).Unregister("default/unregistered.timer")
+
+	NewGauge("bound")
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+	SetDefaultReporter(rep)
+	assert.ElementsMatch(t, []string{"default/bound.gauge", "default/unregistered.timer"}, registered(rep))
+	assert.Nil(t, pendingMetrics)
+}
+
+func TestSetDefaultReporter_concurrent(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			NewCounter("concurrent").Inc(1)
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			SetDefaultReporter(rep)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, registered(rep), 1)
+	assert.Empty(t, pendingMetrics)
+}
+
+func TestSetDefaultReporter_concurrentVec(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	v := NewCounterVec("concurrentVec", []string{"n"})
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Tags(map[string]string{"host": "a"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v.With(strconv.Itoa(i)).Inc(1)
+		}(i)
+	}
+	SetDefaultReporter(rep)
+	wg.Wait()
+
+	pts := v.AddPoints(nil)
+	require.Len(t, pts, 10)
+	for _, p := range pts {
+		assert.Equal(t, "a", p.Tags["host"])
+	}
+}
+
+func TestSetDefaultReporter_statsD(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{Addr: conn.LocalAddr().String(), DogStatsD: true, FlushInterval: time.Hour})
+	require.NoError(t, err)
+
+	counter := NewCounter("pendingStatsD", WithTags(map[string]string{"route": "/"}))
+	v := NewCounterVec("pendingStatsDVec", []string{"code"})
+	v.With("200")
+	counter.Inc(1)
+
+	SetDefaultReporter(NewReporter("", "", Registry(metrics.NewRegistry()), StatsD(c), Tags(map[string]string{"host": "a"})))
+	counter.Inc(2)
+	v.With("200").Inc(3)
+
+	assert.NoError(t, c.Close())
+	assert.Equal(t, "default.pendingStatsD:2|c|#host:a,route:/\ndefault.pendingStatsDVec:3|c|#code:200,host:a",
+		receive(t, packets))
+}
+
+func TestSetDefaultReporter_countsPendingSeries(t *testing.T) {
+	defer withoutDefaultReporter()()
+
+	v := NewCounterVec("pendingSeries", []string{"id"})
+	v.With("1").Inc(1)
+	v.With("2").Inc(1)
+
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), MaxSeries(3, OverflowReject))
+	SetDefaultReporter(rep)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&rep.(*reporter).series))
+
+	v.With("3").Inc(1)
+	v.With("4").Inc(1)
+	assert.Equal(t, int64(1), rep.(StatusReporter).Status().RejectedSeries)
+
+	rep.(Unregisterer).Unregister("default/pendingSeries.count")
+	assert.Equal(t, int64(0), atomic.LoadInt64(&rep.(*reporter).series))
+}
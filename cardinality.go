@@ -0,0 +1,47 @@
+package metrics
+
+import "sync/atomic"
+
+// OverflowValue is the label value of the series taking the values of the series exceeding a cardinality limit.
+const OverflowValue = "__overflow__"
+
+// CardinalityOverflow defines what happens to new series of a vector once a cardinality limit is reached.
+type CardinalityOverflow int
+
+const (
+	// OverflowSeries reports the values of new series in one series with all label values set to OverflowValue.
+	OverflowSeries CardinalityOverflow = iota
+	// OverflowReject discards the values of new series.
+	OverflowReject
+)
+
+func (o CardinalityOverflow) String() string {
+	if o == OverflowReject {
+		return "rejected"
+	}
+	return "reported as " + OverflowValue
+}
+
+// admitSeries counts a new series of a vector. It returns false if the limit of the reporter is reached.
+func (r *reporter) admitSeries() bool {
+	if r.maxSeries <= 0 {
+		return true
+	}
+	for {
+		series := atomic.LoadInt64(&r.series)
+		if series >= int64(r.maxSeries) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&r.series, series, series+1) {
+			return true
+		}
+	}
+}
+
+// countSeries counts existing series of a vector bound to the reporter. They are counted
+// even if the limit is exceeded, so that giving them back does not underflow the count.
+func (r *reporter) countSeries(n int) {
+	if r != nil && r.maxSeries > 0 && n > 0 {
+		atomic.AddInt64(&r.series, int64(n))
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMaxSeries(t *testing.T) {
+	logger := &testLogger{msgs: make(chan string, 10)}
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), WithLogger(logger))
+
+	users := NewCounterVec("logins", []string{"user"}, WithReporter(rep), WithMaxSeries(2, OverflowSeries))
+	for i := 0; i < 5; i++ {
+		users.With("user" + strconv.Itoa(i)).Inc(1)
+	}
+	users.With("user0").Inc(1)
+	users.With("user4").Inc(1)
+
+	var counts = make(map[string]interface{})
+	for _, p := range rep.(*reporter).getPoints(nil) {
+		counts[p.Tags["user"]] = p.Fields["logins.count"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"user0":       int64(2),
+		"user1":       int64(1),
+		OverflowValue: int64(4),
+	}, counts)
+	assert.Equal(t, int64(3), rep.(StatusReporter).Status().RejectedSeries, "a rejected series is counted once")
+
+	require.Len(t, logger.msgs, 1, "the warning is logged once")
+	msg := <-logger.msgs
+	assert.True(t, strings.HasPrefix(msg, "metrics cardinality limit reached: new series are reported as __overflow__"), msg)
+	assert.Contains(t, msg, "default/logins.count")
+}
+
+func TestMaxSeries(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()),
+		MaxSeries(3, OverflowReject), WithLogger(&testLogger{msgs: make(chan string, 10)}))
+
+	a := NewCounterVec("a", []string{"id"}, WithReporter(rep))
+	b := NewTimerVec("b", []string{"id"}, WithReporter(rep))
+	a.With("1").Inc(1)
+	a.With("2").Inc(1)
+	b.With("1").Update(1)
+	b.With("2").Update(1)
+	a.With("3").Inc(1)
+
+	var series []string
+	for _, p := range rep.(*reporter).getPoints(nil) {
+		if p.Tags["bucket"] == "" || p.Tags["bucket"] == "count" {
+			series = append(series, p.Measurement+"/"+p.Tags["id"])
+		}
+	}
+	assert.ElementsMatch(t, []string{"default/1", "default/2", "default/1"}, series)
+	assert.Equal(t, int64(2), rep.(StatusReporter).Status().RejectedSeries)
+
+	// the values of rejected series are discarded, existing series keep working
+	b.With("2").Update(1)
+	a.With("1").Inc(1)
+	assert.Equal(t, int64(2), a.With("1").Count())
+	assert.Equal(t, int64(2), rep.(StatusReporter).Status().RejectedSeries)
+
+	// the overflow behavior of the vector takes precedence
+	c := NewCounterVec("c", []string{"id"}, WithReporter(rep), WithMaxSeries(10, OverflowSeries))
+	c.With("1").Inc(1)
+	c.With("2").Inc(1)
+	assert.Equal(t, int64(4), rep.(StatusReporter).Status().RejectedSeries)
+
+	var pts []string
+	for _, p := range c.AddPoints(nil) {
+		pts = append(pts, p.Tags["id"])
+	}
+	assert.Equal(t, []string{OverflowValue}, pts)
+	assert.Equal(t, int64(2), c.With("3").Count())
+}
+
+func TestWithMaxSeries_rejectedKeys(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), WithLogger(&testLogger{msgs: make(chan string, 10)}))
+
+	users := NewCounterVec("logins", []string{"user"}, WithReporter(rep), WithMaxSeries(1, OverflowReject))
+	for i := 0; i < maxRejectedKeys+10; i++ {
+		users.With("user" + strconv.Itoa(i)).Inc(1)
+	}
+	assert.Equal(t, int64(maxRejectedKeys), rep.(StatusReporter).Status().RejectedSeries)
+
+	// removing a series makes room for a rejected one
+	users.With("user0").(Closer).Close()
+	users.With("user1").Inc(1)
+	assert.Equal(t, int64(1), users.With("user1").Count())
+	assert.Equal(t, int64(maxRejectedKeys), rep.(StatusReporter).Status().RejectedSeries)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChunkError is returned if some chunks of a batch split by MaxBatchPoints or MaxBatchBytes
+// could not be written.
+type ChunkError struct {
+	// Chunks is the number of chunks the batch was split into.
+	Chunks int
+	// Failed maps the index of a failed chunk to its error.
+	Failed map[int]error
+}
+
+func (e *ChunkError) Error() string {
+	indexes := e.indexes()
+	msgs := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		msgs = append(msgs, fmt.Sprintf("chunk %d: %v", i, e.Failed[i]))
+	}
+	return fmt.Sprintf("%d of %d chunks failed: %s", len(e.Failed), e.Chunks, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error of the first failed chunk.
+func (e *ChunkError) Unwrap() error {
+	indexes := e.indexes()
+	if len(indexes) == 0 {
+		return nil
+	}
+	return e.Failed[indexes[0]]
+}
+
+func (e *ChunkError) indexes() []int {
+	indexes := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// chunking defines how batches are split before they are written to a sink.
+type chunking struct {
+	maxPoints   int
+	maxBytes    int
+	concurrency int
+}
+
+func (c chunking) enabled() bool {
+	return c.maxPoints > 0 || c.maxBytes > 0
+}
+
+// split splits the batch into chunks of at most maxPoints points and maxBytes bytes in line
+// protocol. A point exceeding maxBytes on its own is put into a chunk of its own.
+func (c chunking) split(batch Batch) []Batch {
+	if !c.enabled() {
+		return []Batch{batch}
+	}
+
+	var (
+		chunks []Batch
+		start  int
+		size   int
+		buf    []byte
+	)
+	for i, p := range batch.Points {
+		var pointSize int
+		if c.maxBytes > 0 {
+			buf = appendLine(buf[:0], p, batch.Time, "")
+			pointSize = len(buf)
+		}
+
+		full := c.maxPoints > 0 && i-start == c.maxPoints ||
+			c.maxBytes > 0 && size+pointSize > c.maxBytes
+		if full && i != start {
+			chunks = append(chunks, chunkOf(batch, start, i))
+			start, size = i, 0
+		}
+		size += pointSize
+	}
+	return append(chunks, chunkOf(batch, start, len(batch.Points)))
+}
+
+func chunkOf(batch Batch, from, to int) Batch {
+	chunk := batch
+	chunk.Points = batch.Points[from:to:to]
+	return chunk
+}
+
+// writeChunks writes the batch split into chunks to the sink, at most concurrency chunks at a time.
+func (c chunking) writeChunks(ctx context.Context, sink Sink, batch Batch) error {
+	chunks := c.split(batch)
+	if len(chunks) == 1 {
+		return sink.Write(ctx, chunks[0])
+	}
+
+	concurrency := c.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, concurrency)
+		errs = make([]error, len(chunks))
+	)
+	for i, chunk := range chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, chunk Batch) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = sink.Write(ctx, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	chunkErr := &ChunkError{Chunks: len(chunks), Failed: make(map[int]error)}
+	for i, err := range errs {
+		if err != nil {
+			chunkErr.Failed[i] = err
+		}
+	}
+	if len(chunkErr.Failed) == 0 {
+		return nil
+	}
+	return chunkErr
+}
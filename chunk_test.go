@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_chunking_split(t *testing.T) {
+	batch := testBatch(10, time.Unix(1600000000, 0))
+	pointSize := len(appendLine(nil, batch.Points[0], batch.Time, ""))
+
+	tests := []struct {
+		name     string
+		chunking chunking
+		want     []int
+	}{
+		{name: "disabled", want: []int{10}},
+		{name: "points", chunking: chunking{maxPoints: 4}, want: []int{4, 4, 2}},
+		{name: "points exact", chunking: chunking{maxPoints: 5}, want: []int{5, 5}},
+		{name: "bytes", chunking: chunking{maxBytes: 3 * pointSize}, want: []int{3, 3, 3, 1}},
+		{name: "bytes too small", chunking: chunking{maxBytes: 1}, want: []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{name: "points and bytes", chunking: chunking{maxPoints: 2, maxBytes: 3 * pointSize}, want: []int{2, 2, 2, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				sizes  []int
+				points []client.Point
+			)
+			for _, chunk := range tt.chunking.split(batch) {
+				sizes = append(sizes, len(chunk.Points))
+				points = append(points, chunk.Points...)
+				assert.Equal(t, batch.Time, chunk.Time)
+			}
+			assert.Equal(t, tt.want, sizes)
+			assert.Equal(t, batch.Points, points)
+		})
+	}
+}
+
+func Test_chunking_writeChunks(t *testing.T) {
+	var (
+		m       sync.Mutex
+		written int
+		active  int32
+		maxSeen int32
+	)
+	sink := &testSink{writeCall: func(_ context.Context, batch Batch) error {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if batch.Points[0].Fields["value"] == 4 || batch.Points[0].Fields["value"] == 8 {
+			return errors.New("too large")
+		}
+		m.Lock()
+		written += len(batch.Points)
+		m.Unlock()
+		return nil
+	}}
+
+	c := chunking{maxPoints: 2, concurrency: 2}
+	err := c.writeChunks(context.Background(), sink, testBatch(10, time.Unix(1600000000, 0)))
+	require.Error(t, err)
+	assert.EqualError(t, err, "2 of 5 chunks failed: chunk 2: too large; chunk 4: too large")
+	assert.EqualError(t, errors.Unwrap(err), "too large")
+
+	var chunkErr *ChunkError
+	require.True(t, errors.As(err, &chunkErr))
+	assert.Equal(t, 5, chunkErr.Chunks)
+	assert.Len(t, chunkErr.Failed, 2)
+
+	assert.Equal(t, 6, written)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxSeen))
+
+	assert.NoError(t, chunking{maxPoints: 5}.writeChunks(context.Background(), okSink(), testBatch(10, time.Unix(1600000000, 0))))
+}
+
+func TestMaxBatchPoints(t *testing.T) {
+	var sizes []int
+	sink := &testSink{writeCall: func(_ context.Context, batch Batch) error {
+		sizes = append(sizes, len(batch.Points))
+		return nil
+	}}
+
+	rep := NewSinkReporter(sink, Registry(metrics.NewRegistry()), MaxBatchPoints(2))
+	NewGauge("gauge1", WithReporter(rep)).Update(1)
+	NewGauge("gauge2", WithReporter(rep)).Update(2)
+	NewGauge("gauge3", WithReporter(rep)).Update(3)
+
+	require.NoError(t, rep.(Shutdowner).Shutdown(context.Background()))
+	assert.Equal(t, []int{2, 1}, sizes)
+}
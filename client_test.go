@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client"
@@ -11,7 +12,7 @@ type testClient struct {
 	pingCall  func() (time.Duration, string, error)
 }
 
-func (s *testClient) Write(points client.BatchPoints) (*client.Response, error) {
+func (s *testClient) Write(_ context.Context, points client.BatchPoints) (*client.Response, error) {
 	return s.writeCall(points)
 }
 
@@ -1,12 +1,37 @@
 package metrics
 
 import (
+	"context"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client"
 )
 
+// dbClient defines the client used by the InfluxDB sink.
 type dbClient interface {
-	Write(points client.BatchPoints) (*client.Response, error)
+	Write(ctx context.Context, points client.BatchPoints) (*client.Response, error)
 	Ping() (time.Duration, string, error)
 }
+
+// appendLine appends the point in line protocol to b. The given time is used if the point has none.
+func appendLine(b []byte, p client.Point, t time.Time, precision string) []byte {
+	if p.Time.IsZero() {
+		p.Time = t
+	}
+	p.Precision = lineProtocolPrecision(precision)
+
+	b = append(b, p.MarshalString()...)
+	return append(b, '\n')
+}
+
+// lineProtocolPrecision translates the precision of the write API (ns, us, ms, s)
+// to the one used when marshalling a point.
+func lineProtocolPrecision(precision string) string {
+	switch precision {
+	case "us":
+		return "u"
+	case "ns":
+		return "n"
+	}
+	return precision
+}
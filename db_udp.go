@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// DefaultUDPPayloadSize is the default maximum size of a UDP packet sent to InfluxDB.
+const DefaultUDPPayloadSize = 512
+
+// udpClient implements the dbClient interface for the UDP listener of InfluxDB 1.x.
+// Writes are fire-and-forget: the batch is split into packets of the maximum payload size.
+type udpClient struct {
+	conn        net.Conn
+	payloadSize int
+	precision   string
+}
+
+func newUDPClient(s InfluxConfig) (*udpClient, error) {
+	conn, err := net.Dial("udp", s.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadSize := s.PayloadSize
+	if payloadSize == 0 {
+		payloadSize = DefaultUDPPayloadSize
+	}
+	return &udpClient{
+		conn:        conn,
+		payloadSize: payloadSize,
+		precision:   s.Precision,
+	}, nil
+}
+
+// Write sends the points in line protocol. Points are packed into packets up to the payload size.
+// A point exceeding the payload size is sent in a packet of its own.
+func (c *udpClient) Write(_ context.Context, bp client.BatchPoints) (*client.Response, error) {
+	var (
+		buf  = make([]byte, 0, c.payloadSize)
+		line []byte
+		err  error
+	)
+	for _, p := range bp.Points {
+		line = appendLine(line[:0], p, bp.Time, c.precision)
+
+		if len(buf) != 0 && len(buf)+len(line) > c.payloadSize {
+			if _, wErr := c.conn.Write(buf); wErr != nil {
+				err = wErr
+			}
+			buf = buf[:0]
+		}
+		buf = append(buf, line...)
+	}
+
+	if len(buf) != 0 {
+		if _, wErr := c.conn.Write(buf); wErr != nil {
+			err = wErr
+		}
+	}
+	return nil, err
+}
+
+// Close closes the connection.
+func (c *udpClient) Close() error {
+	return c.conn.Close()
+}
+
+// Ping is a no-op since UDP is connectionless.
+func (c *udpClient) Ping() (time.Duration, string, error) {
+	return 0, "", nil
+}
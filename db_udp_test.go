@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_udpClient_Write(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	u, _ := url.Parse("udp://" + conn.LocalAddr().String())
+	c, err := newUDPClient(InfluxConfig{URL: *u, PayloadSize: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pts []client.Point
+	for i := 0; i < 3; i++ {
+		pts = append(pts, getPoint("measure", map[string]interface{}{"field": 1.5}, map[string]string{"tag": "val"}))
+	}
+	_, err = c.Write(context.Background(), client.BatchPoints{Points: pts, Time: time.Unix(1, 0)})
+	assert.NoError(t, err)
+
+	line := "measure,tag=val field=1.5 1000000000\n"
+	assert.Equal(t, strings.Repeat(line, 2), receive(t, packets))
+	assert.Equal(t, line, receive(t, packets))
+}
+
+func TestNewReporter_udp(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	reporter := NewReporter("udp://"+conn.LocalAddr().String(), "",
+		Interval(30*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	NewGauge("udpGauge", WithReporter(reporter), WithMeasurement("measure")).Update(5)
+
+	assert.True(t, strings.HasPrefix(receive(t, packets), "measure udpGauge.gauge=5i "))
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// v1Client implements the dbClient interface for the write API of InfluxDB 1.x.
+// Other than the client of influxdb1-client it cancels requests with the context of the write.
+type v1Client struct {
+	url        url.URL
+	user       string
+	pass       string
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newV1Client(s InfluxConfig, httpClient *http.Client) *v1Client {
+	return &v1Client{
+		url:        s.URL,
+		user:       s.User,
+		pass:       s.Pass,
+		userAgent:  s.UserAgent,
+		httpClient: httpClient,
+	}
+}
+
+// Write sends the points in line protocol to the `/write` endpoint.
+func (c *v1Client) Write(ctx context.Context, bp client.BatchPoints) (*client.Response, error) {
+	var body []byte
+	for _, p := range bp.Points {
+		body = appendLine(body, p, bp.Time, bp.Precision)
+	}
+
+	u := c.url
+	u.Path = path.Join(u.Path, "write")
+
+	params := url.Values{}
+	params.Set("db", bp.Database)
+	if bp.RetentionPolicy != "" {
+		params.Set("rp", bp.RetentionPolicy)
+	}
+	if bp.Precision != "" {
+		params.Set("precision", bp.Precision)
+	}
+	if bp.WriteConsistency != "" {
+		params.Set("consistency", bp.WriteConsistency)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("influxdb write failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+		return &client.Response{Err: err}, err
+	}
+	return nil, nil
+}
+
+// Ping checks if the server is up. It returns how long the request took and the version of the server.
+func (c *v1Client) Ping() (time.Duration, string, error) {
+	now := time.Now()
+
+	u := c.url
+	u.Path = path.Join(u.Path, "ping")
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("influxdb ping failed with status %d", resp.StatusCode)
+	}
+	return time.Since(now), resp.Header.Get("X-Influxdb-Version"), nil
+}
+
+func (c *v1Client) setHeaders(req *http.Request) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+}
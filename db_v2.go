@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// v2Client implements the dbClient interface for the InfluxDB 2.x write API.
+type v2Client struct {
+	url        url.URL
+	org        string
+	bucket     string
+	token      string
+	gzip       bool
+	precision  string
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newV2Client(s InfluxConfig, httpClient *http.Client) *v2Client {
+	return &v2Client{
+		url:        s.URL,
+		org:        s.Org,
+		bucket:     s.Bucket,
+		token:      s.Token,
+		gzip:       s.Gzip,
+		precision:  s.Precision,
+		userAgent:  s.UserAgent,
+		httpClient: httpClient,
+	}
+}
+
+// Write sends the points in line protocol to the `/api/v2/write` endpoint.
+func (c *v2Client) Write(ctx context.Context, bp client.BatchPoints) (*client.Response, error) {
+	body, err := c.encode(bp)
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.url
+	u.Path = path.Join(u.Path, "api/v2/write")
+
+	params := url.Values{}
+	params.Set("org", c.org)
+	params.Set("bucket", c.bucket)
+	if c.precision != "" {
+		params.Set("precision", c.precision)
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("influxdb v2 write failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+		return &client.Response{Err: err}, err
+	}
+	return nil, nil
+}
+
+// Ping checks if the server is up. It returns how long the request took and the version of the server.
+func (c *v2Client) Ping() (time.Duration, string, error) {
+	now := time.Now()
+
+	u := c.url
+	u.Path = path.Join(u.Path, "ping")
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("influxdb v2 ping failed with status %d", resp.StatusCode)
+	}
+	return time.Since(now), resp.Header.Get("X-Influxdb-Version"), nil
+}
+
+func (c *v2Client) setAuth(req *http.Request) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+}
+
+func (c *v2Client) encode(bp client.BatchPoints) (*bytes.Buffer, error) {
+	var b bytes.Buffer
+	lines := c.lineProtocol(bp)
+	if !c.gzip {
+		b.Write(lines)
+		return &b, nil
+	}
+
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(lines); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (c *v2Client) lineProtocol(bp client.BatchPoints) []byte {
+	var b []byte
+	for _, p := range bp.Points {
+		b = appendLine(b, p, bp.Time, c.precision)
+	}
+	return b
+}
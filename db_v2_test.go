@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/tehsphinx/concurrent"
+)
+
+func Test_v2Client_Write(t *testing.T) {
+	type fields struct {
+		gzip      bool
+		precision string
+	}
+	tests := []struct {
+		name          string
+		fields        fields
+		status        int
+		wantPrecision string
+		wantBody      string
+		wantErr       bool
+	}{
+		{
+			name:     "plain",
+			status:   http.StatusNoContent,
+			wantBody: "measure,tag1=val1 field=5.5 1577880000000000000\n",
+		},
+		{
+			name: "gzip with precision",
+			fields: fields{
+				gzip:      true,
+				precision: "s",
+			},
+			status:        http.StatusNoContent,
+			wantPrecision: "s",
+			wantBody:      "measure,tag1=val1 field=5.5 1577880000\n",
+		},
+		{
+			name:     "error status",
+			status:   http.StatusUnauthorized,
+			wantBody: "measure,tag1=val1 field=5.5 1577880000000000000\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, http.MethodPost, req.Method)
+				assert.Equal(t, "/api/v2/write", req.URL.Path)
+				assert.Equal(t, "myOrg", req.URL.Query().Get("org"))
+				assert.Equal(t, "myBucket", req.URL.Query().Get("bucket"))
+				assert.Equal(t, tt.wantPrecision, req.URL.Query().Get("precision"))
+				assert.Equal(t, "Token myToken", req.Header.Get("Authorization"))
+
+				var body io.Reader = req.Body
+				if tt.fields.gzip {
+					assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+					gz, err := gzip.NewReader(req.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					body = gz
+				}
+				b, err := ioutil.ReadAll(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantBody, string(b))
+
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			u, _ := url.Parse(srv.URL)
+			c := newV2Client(InfluxConfig{
+				URL:       *u,
+				V2:        true,
+				Org:       "myOrg",
+				Bucket:    "myBucket",
+				Token:     "myToken",
+				Gzip:      tt.fields.gzip,
+				Precision: tt.fields.precision,
+			}, http.DefaultClient)
+
+			_, err := c.Write(context.Background(), client.BatchPoints{
+				Points: []client.Point{
+					getPoint("measure", map[string]interface{}{"field": 5.5}, map[string]string{"tag1": "val1"}),
+				},
+				Time: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+			})
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_v2Client_Ping(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/ping", req.URL.Path)
+		w.Header().Set("X-Influxdb-Version", "2.0.0")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	_, version, err := newV2Client(InfluxConfig{URL: *u, V2: true}, http.DefaultClient).Ping()
+	assert.NoError(t, err)
+	assert.Equal(t, "2.0.0", version)
+}
+
+func TestNewReporterV2(t *testing.T) {
+	var count = concurrent.NewInt()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/v2/write" {
+			count.Increase()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	reporter := NewReporterV2(srv.URL, "myOrg", "myBucket", "myToken",
+		Interval(30*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+		Gzip(),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	NewCounter("testCounter", WithReporter(reporter)).Inc(1)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NotEmpty(t, count.Get())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/tehsphinx/metrics"
+)
+
+func main() {
+	primary, _ := url.Parse("http://localhost:8086")
+	secondary, _ := url.Parse("http://backup:8086")
+
+	// Initialize one reporter sending the same data to two InfluxDB servers.
+	// The secondary server gets a short timeout so it cannot delay the primary one.
+	rep := metrics.NewSinkReporter(metrics.NewInfluxSink(metrics.InfluxConfig{URL: *primary, DB: "metrics"}),
+		metrics.Interval(1*time.Second),
+		metrics.WithSink(metrics.NewInfluxSink(metrics.InfluxConfig{URL: *secondary, DB: "metrics"}),
+			metrics.SinkTimeout(200*time.Millisecond),
+			metrics.OnSinkError(func(err error) {
+				log.Printf("secondary InfluxDB: %v", err)
+			}),
+		),
+	)
+	metrics.SetDefaultReporter(rep)
+
+	// Start reporting all registered or to be registered metrics.
+	go rep.Run()
+
+	// Create and register a new gauge metric.
+	m := metrics.NewGauge("Test", metrics.WithMeasurement("measure"))
+	for {
+		time.Sleep(600 * time.Millisecond)
+		n := rand.Int63n(50)
+		// Update the gauge metric value.
+		m.Update(n)
+	}
+}
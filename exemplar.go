@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ExemplarUpdater is implemented by the histograms of this package. UpdateWithExemplar samples
+// a value and keeps it as exemplar with the given labels, see Histogram.
+type ExemplarUpdater interface {
+	UpdateWithExemplar(v int64, labels map[string]string)
+}
+
+// TimerExemplarUpdater is implemented by the timers of this package. UpdateWithExemplar records
+// a duration and keeps it as exemplar with the given labels, see Timer.
+type TimerExemplarUpdater interface {
+	UpdateWithExemplar(d time.Duration, labels map[string]string)
+}
+
+// exemplar references a single observation, e.g. to link it to a trace.
+type exemplar struct {
+	labels map[string]string
+	value  float64
+	time   time.Time
+}
+
+// exemplarStore holds the latest exemplar of a metric. It is safe for concurrent use.
+type exemplarStore struct {
+	latest atomic.Value
+}
+
+func (s *exemplarStore) store(value float64, labels map[string]string) {
+	s.latest.Store(&exemplar{
+		labels: labels,
+		value:  value,
+		time:   time.Now(),
+	})
+}
+
+// load returns the latest exemplar or nil if none has been stored.
+func (s *exemplarStore) load() *exemplar {
+	e, _ := s.latest.Load().(*exemplar)
+	return e
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exemplarStore(t *testing.T) {
+	var s exemplarStore
+	assert.Nil(t, s.load())
+
+	s.store(1.5, map[string]string{"trace_id": "abc"})
+	s.store(2.5, map[string]string{"trace_id": "def"})
+
+	e := s.load()
+	assert.Equal(t, 2.5, e.value)
+	assert.Equal(t, map[string]string{"trace_id": "def"}, e.labels)
+	assert.False(t, e.time.IsZero())
+}
+
+func Test_timer_UpdateWithExemplar(t *testing.T) {
+	r := NewReporter("", "", Registry(metrics.NewRegistry()))
+	m := newTimer("exemplarTimer", WithReporter(r))
+
+	m.UpdateWithExemplar(250*time.Millisecond, map[string]string{"trace_id": "abc"})
+
+	assert.Equal(t, int64(1), m.Count())
+	assert.Equal(t, 0.25, m.exemplars.load().value)
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Closer is implemented by all metrics of this package, e.g. `counter.(metrics.Closer).Close()`.
+// Close removes the metric from its reporter, see the Close method of the metrics.
+type Closer interface {
+	Close()
+}
+
+// baser gives access to the baseMetric of a metric of this package.
+type baser interface {
+	base() *baseMetric
+}
+
+func (s *baseMetric) base() *baseMetric {
+	return s
+}
+
+// Close removes the metric from its reporter: its data points are not reported anymore.
+// Reporters not implementing Unregisterer keep the metric.
+// Creating a metric with the same name afterwards registers a new one.
+func (s *baseMetric) Close() {
+	atomic.StoreInt32(&s.state, stateClosed)
+	if s.parent != nil {
+		s.parent.remove(s)
+		return
+	}
+
+	name := s.regName()
+	removePending(s)
+	if u, ok := s.reporter.(Unregisterer); ok {
+		if b, ok := s.reporter.Get(name); ok && isBase(b, s) {
+			u.Unregister(name)
+		}
+	}
+
+	// metrics created before a default reporter was set are registered to the default registry
+	if b := metrics.DefaultRegistry.Get(name); isBase(b, s) {
+		if v, ok := b.(vecMetric); ok {
+			v.release()
+		}
+		metrics.DefaultRegistry.Unregister(name)
+	}
+}
+
+func isBase(m interface{}, s *baseMetric) bool {
+	b, ok := m.(baser)
+	return ok && b.base() == s
+}
+
+// Close removes the meter from its reporter and stops it.
+func (s *meter) Close() {
+	s.baseMetric.Close()
+	s.Meter.Stop()
+}
+
+// Close removes the timer from its reporter and stops it.
+func (s *timer) Close() {
+	s.baseMetric.Close()
+	s.Timer.Stop()
+}
+
+func (s *meter) restart() {
+	s.restartable.restart()
+}
+
+func (s *timer) restart() {
+	s.restartable.restart()
+}
+
+// Unregister removes the metric with the given name and stops meters and timers. Its data points
+// are not reported anymore.
+func (r *reporter) Unregister(name string) {
+	m := r.registry.Get(name)
+	if v, ok := m.(vecMetric); ok {
+		v.release()
+	}
+	r.registry.Unregister(name)
+	stopMetric(m)
+}
+
+// expire removes the metrics and children of vectors not updated for ttl intervals and stops
+// meters and timers. A metric the caller still holds is registered again with its next update.
+func (r *reporter) expire(now time.Time) {
+	ttl := time.Duration(r.ttl) * r.interval
+
+	var idle []string
+	r.registry.Each(func(name string, data interface{}) {
+		switch m := data.(type) {
+		case vecMetric:
+			m.expire(ttl, now)
+		case baser:
+			if m.base().idle(ttl, now) {
+				idle = append(idle, name)
+			}
+		}
+	})
+
+	r.expireMutex.Lock()
+	defer r.expireMutex.Unlock()
+
+	for _, name := range idle {
+		m, ok := r.registry.Get(name).(baser)
+		if !ok {
+			continue
+		}
+
+		// an update racing with the expiry either sees the state or is seen by the second check
+		b := m.base()
+		if !atomic.CompareAndSwapInt32(&b.state, stateActive, stateExpired) {
+			continue
+		}
+		if !b.idle(ttl, now) {
+			atomic.CompareAndSwapInt32(&b.state, stateExpired, stateActive)
+			continue
+		}
+		r.registry.Unregister(name)
+		stopMetric(m)
+	}
+}
+
+// revive registers an expired metric again that got updated and restarts its meter. If a metric
+// of the same name was created in the meantime, the expired one is not reported anymore.
+func (r *reporter) revive(m Metric) {
+	r.expireMutex.Lock()
+	defer r.expireMutex.Unlock()
+
+	b := m.(baser).base()
+	if !atomic.CompareAndSwapInt32(&b.state, stateExpired, stateActive) {
+		return
+	}
+	restartMetric(m)
+
+	name := b.regName()
+	if _, ok := r.Get(name); ok {
+		return
+	}
+	_ = r.Register(name, m)
+}
+
+// touch records the time of an update. A metric that expired while the caller still holds it
+// is reported again. It must be called before updating the metric: the meter is restarted.
+func (s *baseMetric) touch(m Metric) {
+	atomic.StoreInt64(&s.updated, time.Now().UnixNano())
+	if atomic.LoadInt32(&s.state) != stateExpired {
+		return
+	}
+	if s.parent != nil {
+		s.parent.revive(m)
+		return
+	}
+	if r, ok := s.reporter.(*reporter); ok {
+		r.revive(m)
+	}
+}
+
+// idle returns true if the metric has not been updated for ttl.
+func (s *baseMetric) idle(ttl time.Duration, now time.Time) bool {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.updated))) >= ttl
+}
+
+// stopMetric stops the go routines of meters and timers.
+func stopMetric(m interface{}) {
+	if s, ok := m.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+}
+
+// releaseSeries gives back series of vectors counted against the cardinality limit.
+func (r *reporter) releaseSeries(n int) {
+	if r != nil && r.maxSeries > 0 && n > 0 {
+		atomic.AddInt64(&r.series, -int64(n))
+	}
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registered(rep Reporter) []string {
+	var names []string
+	rep.(*reporter).registry.Each(func(name string, _ interface{}) {
+		names = append(names, name)
+	})
+	return names
+}
+
+func TestMetric_Close(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	c := NewCounter("counter", WithReporter(rep))
+	NewTimer("timer", WithReporter(rep))
+	assert.ElementsMatch(t, []string{"default/counter.count", "default/timer.timer"}, registered(rep))
+
+	c.(Closer).Close()
+	assert.Equal(t, []string{"default/timer.timer"}, registered(rep))
+
+	// closing again does not remove a new metric with the same name
+	c2 := NewCounter("counter", WithReporter(rep))
+	assert.False(t, c == c2)
+	c.(Closer).Close()
+	assert.Len(t, registered(rep), 2)
+
+	NewTimer("timer", WithReporter(rep)).(Closer).Close()
+	assert.Equal(t, []string{"default/counter.count"}, registered(rep))
+
+	rep.(Unregisterer).Unregister("default/counter.count")
+	assert.Empty(t, registered(rep))
+}
+
+func TestVec_Close(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), MaxSeries(2, OverflowReject))
+	r := rep.(*reporter)
+
+	v := NewCounterVec("requests", []string{"code"}, WithReporter(rep))
+	v.With("200").Inc(1)
+	v.With("500").Inc(1)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&r.series))
+
+	v.With("500").(Closer).Close()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&r.series))
+	require.Len(t, r.getPoints(nil), 1)
+
+	v.With("404").Inc(1)
+	assert.Len(t, r.getPoints(nil), 2)
+	assert.Equal(t, int64(0), rep.(StatusReporter).Status().RejectedSeries)
+
+	v.Close()
+	assert.Empty(t, registered(rep))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&r.series))
+}
+
+func Test_reporter_expire(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Interval(time.Second), TTL(2), MaxSeries(10, OverflowReject))
+	r := rep.(*reporter)
+
+	idle := NewCounter("idle", WithReporter(rep))
+	idle.Inc(1)
+	v := NewTimerVec("jobs", []string{"job"}, WithReporter(rep))
+	v.With("a").Update(1)
+	held := v.With("b")
+	held.Update(1)
+
+	now := time.Now()
+	r.expire(now)
+	assert.Len(t, v.AddPoints(nil), 2*len(v.With("a").(*timer).buckets))
+
+	// the time of the last update counts, not a change of the values
+	v.With("b").(*timer).updated = now.Add(-3 * time.Second).UnixNano()
+	r.expire(now)
+
+	var jobs []string
+	v.each(func(m Metric) {
+		jobs = append(jobs, m.(*timer).tags["job"])
+	})
+	assert.Equal(t, []string{"a"}, jobs)
+
+	// other metrics expire as well, vectors are kept
+	r.expire(now.Add(time.Hour))
+	assert.Equal(t, []string{"default/jobs.timer"}, registered(rep))
+	assert.Empty(t, v.AddPoints(nil))
+
+	// an expired child still held by the caller is reported again with its next update
+	held.Update(1)
+	assert.Equal(t, int64(2), v.With("b").Count())
+	assert.True(t, held == v.With("b"))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&r.series))
+
+	// so is an expired metric
+	idle.Inc(1)
+	assert.ElementsMatch(t, []string{"default/idle.count", "default/jobs.timer"}, registered(rep))
+	assert.Equal(t, int64(2), idle.Count())
+}
+
+func Test_reporter_expire_meters(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Interval(time.Second), TTL(1))
+	r := rep.(*reporter)
+
+	m := NewMeter("events", WithReporter(rep))
+	m.Mark(1)
+	held := NewTimerVec("jobs", []string{"job"}, WithReporter(rep)).With("a")
+	held.Update(time.Second)
+	closed := NewMeter("closed", WithReporter(rep))
+
+	r.expire(time.Now().Add(time.Hour))
+	closed.(Closer).Close()
+	assert.Equal(t, []string{"default/jobs.timer"}, registered(rep))
+
+	// the meters are stopped while expired and restarted with the next update
+	m.(*meter).restartable.meter().Mark(1)
+	assert.Equal(t, int64(1), m.Count())
+	m.Mark(2)
+	assert.Equal(t, int64(2), m.Count())
+
+	stopped := held.(*timer).restartable.timer()
+	held.Update(time.Second)
+	assert.False(t, stopped == held.(*timer).restartable.timer())
+	assert.Equal(t, int64(2), held.Count())
+
+	// a closed metric is not reported again
+	closed.Mark(1)
+	assert.ElementsMatch(t, []string{"default/events.meter", "default/jobs.timer"}, registered(rep))
+}
+
+func Test_reporter_Unregister_stops(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	m := NewMeter("events", WithReporter(rep))
+	tm := NewTimer("latency", WithReporter(rep))
+	rep.(Unregisterer).Unregister("default/events.meter")
+	rep.(Unregisterer).Unregister("default/latency.timer")
+
+	m.Mark(1)
+	tm.Update(time.Second)
+	assert.Equal(t, int64(0), m.Count())
+	assert.Equal(t, 0.0, tm.RateMean())
+}
+
+func Test_vec_expire_concurrentUpdate(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Interval(time.Second), TTL(1))
+	r := rep.(*reporter)
+
+	v := NewCounterVec("jobs", []string{"job"}, WithReporter(rep))
+	held := v.With("a")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			held.Inc(1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.expire(time.Now().Add(time.Hour))
+	}
+	<-done
+	held.Inc(1)
+
+	assert.Equal(t, int64(1001), v.With("a").Count())
+	assert.True(t, held == v.With("a"))
+}
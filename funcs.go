@@ -53,3 +53,42 @@ func getPoint(measurement string, fields map[string]interface{}, tags map[string
 		Fields:      fields,
 	}
 }
+
+func clonePoints(pts []client.Point) []client.Point {
+	cp := make([]client.Point, len(pts))
+	for i, pt := range pts {
+		fields := make(map[string]interface{}, len(pt.Fields))
+		for k, v := range pt.Fields {
+			fields[k] = v
+		}
+		pt.Fields = fields
+		cp[i] = pt
+	}
+	return cp
+}
+
+// floatValue converts a numeric field value to float64. Returns false for non numeric values.
+func floatValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
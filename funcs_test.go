@@ -3,6 +3,7 @@ package metrics
 import (
 	"testing"
 
+	client "github.com/influxdata/influxdb1-client"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -121,3 +122,14 @@ func Test_composeTags(t *testing.T) {
 		})
 	}
 }
+
+func Test_clonePoints(t *testing.T) {
+	fields := map[string]interface{}{"field": 1.0}
+	pts := []client.Point{getPoint("measure", fields, map[string]string{"tag": "val"})}
+
+	got := clonePoints(pts)
+	fields["field"] = 2.0
+
+	assert.Equal(t, 1.0, got[0].Fields["field"])
+	assert.Equal(t, pts[0].Tags, got[0].Tags)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import "time"
+
+// FlushStats describes a write of a batch to a sink.
+type FlushStats struct {
+	// Sink is the index of the sink in the order the sinks were added to the reporter.
+	Sink int
+	// Points is the number of data points written.
+	Points int
+	// Duration is the time the write took.
+	Duration time.Duration
+	// Err is the error of the write, if any.
+	Err error
+}
+
+// hooks holds the callbacks of a reporter. They are called from the go routines of the
+// sinks, concurrently if the reporter has multiple sinks, and must not block. Points dropped
+// because a sink is still busy are reported from the go routine running the reporter.
+type hooks struct {
+	onWriteError func(err error, points int)
+	onReconnect  func(sink int)
+	onPingError  func(err error)
+	onDrop       func(points int)
+	onFlush      func(stats FlushStats)
+}
+
+func (h *hooks) writeError(err error, points int) {
+	if h != nil && h.onWriteError != nil {
+		h.onWriteError(err, points)
+	}
+}
+
+func (h *hooks) reconnect(sink int) {
+	if h != nil && h.onReconnect != nil {
+		h.onReconnect(sink)
+	}
+}
+
+func (h *hooks) pingError(err error) {
+	if h != nil && h.onPingError != nil {
+		h.onPingError(err)
+	}
+}
+
+func (h *hooks) drop(points int) {
+	if h != nil && h.onDrop != nil {
+		h.onDrop(points)
+	}
+}
+
+func (h *hooks) flush(stats FlushStats) {
+	if h != nil && h.onFlush != nil {
+		h.onFlush(stats)
+	}
+}
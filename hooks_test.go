@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPinger struct {
+	testSink
+	m       sync.Mutex
+	pingErr error
+}
+
+func (s *testPinger) Ping() (time.Duration, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return time.Millisecond, s.pingErr
+}
+
+func (s *testPinger) setPingErr(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.pingErr = err
+}
+
+func TestReporter_hooks(t *testing.T) {
+	var (
+		flushes     = make(chan FlushStats, 10)
+		writeErrors = make(chan int, 10)
+		dropped     = make(chan int, 10)
+	)
+	sink := &testSink{writeCall: func(_ context.Context, _ Batch) error {
+		return errors.New("unavailable")
+	}}
+
+	reporter := NewSinkReporter(sink,
+		Interval(10*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+		OnFlush(func(stats FlushStats) { flushes <- stats }),
+		OnWriteError(func(err error, points int) {
+			assert.EqualError(t, err, "unavailable")
+			writeErrors <- points
+		}),
+		OnDroppedPoints(func(points int) { dropped <- points }),
+		WithSink(&testSink{writeCall: func(_ context.Context, _ Batch) error { return nil }}, OnSinkError(func(error) {})),
+		WithLogger(&testLogger{msgs: make(chan string, 100)}),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	NewGauge("testGauge", WithReporter(reporter)).Update(5)
+
+	var sinks = make(map[int]bool)
+	for len(sinks) < 2 {
+		select {
+		case stats := <-flushes:
+			sinks[stats.Sink] = true
+			assert.Equal(t, 1, stats.Points)
+			assert.Equal(t, stats.Sink == 0, stats.Err != nil)
+		case <-time.After(time.Second):
+			t.Fatal("flush not reported")
+		}
+	}
+	assert.Equal(t, 1, <-writeErrors)
+	assert.Equal(t, 1, <-dropped)
+}
+
+func Test_sinkWorker_reconnect(t *testing.T) {
+	var (
+		reconnects int
+		pingErrors int
+	)
+	sink := &testPinger{pingErr: errors.New("refused")}
+
+	w := newSinkWorker(sink, OnSinkError(func(error) {}))
+	w.index = 1
+	w.hooks = &hooks{
+		onReconnect: func(sink int) {
+			assert.Equal(t, 1, sink)
+			reconnects++
+		},
+		onPingError: func(err error) {
+			pingErrors++
+		},
+	}
+
+	assert.False(t, w.ping())
+	assert.False(t, w.ping())
+	sink.setPingErr(nil)
+	assert.True(t, w.ping())
+	assert.True(t, w.ping())
+
+	assert.Equal(t, 2, pingErrors)
+	assert.Equal(t, 1, reconnects)
+}
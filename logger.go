@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Logger receives the errors of a reporter. The method matches the one of *slog.Logger,
+// so a slog logger can be used directly: `metrics.WithLogger(slog.Default())`.
+// Without logger the errors are written with the standard log package.
+type Logger interface {
+	Error(msg string, args ...interface{})
+}
+
+// NewStdLogger adapts a logger of the standard log package. The messages are written in the
+// key=value format of the slog text handler: `level=ERROR msg="metrics sink error" error="..."`.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s *stdLogger) Error(msg string, args ...interface{}) {
+	s.l.Println(formatLogLine("ERROR", msg, args))
+}
+
+// formatLogLine formats the message and its key value pairs like the slog text handler does.
+func formatLogLine(level, msg string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString("level=" + level + " msg=" + logValue(msg))
+
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			b.WriteString(" !BADKEY=" + logValue(fmt.Sprint(args[i])))
+			i--
+			continue
+		}
+		b.WriteString(" " + key + "=" + logValue(fmt.Sprint(args[i+1])))
+	}
+	return b.String()
+}
+
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
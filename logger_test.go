@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		args []interface{}
+		want string
+	}{
+		{
+			name: "message",
+			msg:  "failed",
+			want: "level=ERROR msg=failed\n",
+		},
+		{
+			name: "attributes",
+			msg:  "metrics sink error",
+			args: []interface{}{"error", errors.New("unable to send metrics: timeout"), "points", 5},
+			want: `level=ERROR msg="metrics sink error" error="unable to send metrics: timeout" points=5` + "\n",
+		},
+		{
+			name: "missing value",
+			msg:  "failed",
+			args: []interface{}{"key"},
+			want: "level=ERROR msg=failed !BADKEY=key\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			NewStdLogger(log.New(&buf, "", 0)).Error(tt.msg, tt.args...)
+
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+const (
+	suffBuckets = ".buckets"
+
+	// leTag holds the upper bound of a bucket.
+	leTag = "le"
+)
+
+// DefaultBuckets are the upper bounds used by NewBucketHistogram if none are given.
+// They are suited to measure durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// BucketHistogram counts observations in buckets with fixed upper bounds. Other than the sampled
+// Histogram its cumulative bucket counts can be summed up across hosts to compute quantiles.
+type BucketHistogram interface {
+	// Observe adds a value to the bucket with the smallest upper bound greater or equal to it.
+	Observe(v float64)
+	// Count returns the number of observations.
+	Count() int64
+	// Sum returns the sum of all observed values.
+	Sum() float64
+	// Buckets returns the upper bounds, ending with +Inf, and the number of observations
+	// less or equal to each of them.
+	Buckets() ([]float64, []int64)
+}
+
+// LinearBuckets returns count upper bounds, the first being start and each
+// following one width greater than the previous.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 || width <= 0 {
+		panic(fmt.Sprintf("metrics: linear buckets need a positive count and width, got %d and %v", count, width))
+	}
+
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start + float64(i)*width
+	}
+	return buckets
+}
+
+// ExponentialBuckets returns count upper bounds, the first being start and each
+// following one factor times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 || start <= 0 || factor <= 1 {
+		panic(fmt.Sprintf("metrics: exponential buckets need a positive count and start and a factor greater 1, got %d, %v and %v",
+			count, start, factor))
+	}
+
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// NewBucketHistogram creates a new histogram with the given upper bounds or retrieves an existing
+// one with the same name. The bounds must be increasing, a bucket for +Inf is added.
+// If no bounds are given DefaultBuckets are used.
+func NewBucketHistogram(name string, buckets []float64, options ...Option) BucketHistogram {
+	return newBucketHistogram(name, buckets, options...)
+}
+
+func newBucketHistogram(name string, buckets []float64, options ...Option) *bucketHistogram {
+	m := newMetric(name, options...)
+	m.suffix = suffBuckets
+
+	bounds := upperBounds(name, buckets)
+	t := &bucketHistogram{
+		baseMetric: *m,
+		fieldName:  m.name + m.suffix,
+		bounds:     bounds,
+		values:     &bucketValues{counts: make([]uint64, len(bounds))},
+	}
+	t.rebind()
+	return m.register(t).(*bucketHistogram)
+}
+
+// upperBounds validates the bounds and appends +Inf.
+func upperBounds(name string, buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	bounds := make([]float64, 0, len(buckets)+1)
+	for i, b := range buckets {
+		if i == len(buckets)-1 && math.IsInf(b, 1) {
+			break
+		}
+		if math.IsNaN(b) || i > 0 && b <= buckets[i-1] {
+			panic(fmt.Sprintf("metrics: %s: bucket bounds must be increasing, got %v", name, buckets))
+		}
+		bounds = append(bounds, b)
+	}
+	return append(bounds, math.Inf(1))
+}
+
+type bucketHistogram struct {
+	baseMetric
+	healthcheck
+	fieldName string
+	bounds    []float64
+	values    *bucketValues
+	leTags    []map[string]string
+	sumTags   map[string]string
+	countTags map[string]string
+	sender    statsdSender
+}
+
+// bucketValues holds the counters updated atomically.
+type bucketValues struct {
+	sumBits uint64
+	counts  []uint64
+}
+
+// Observe adds a value to the bucket with the smallest upper bound greater or equal to it.
+func (s *bucketHistogram) Observe(v float64) {
+	s.touch(s)
+
+	i := sort.SearchFloat64s(s.bounds, v)
+	if i == len(s.bounds) {
+		// NaN is counted in the +Inf bucket
+		i--
+	}
+	atomic.AddUint64(&s.values.counts[i], 1)
+
+	for {
+		old := atomic.LoadUint64(&s.values.sumBits)
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&s.values.sumBits, old, next) {
+			break
+		}
+	}
+
+	s.sender.observe(statsdHistogram, v)
+}
+
+// Count returns the number of observations.
+func (s *bucketHistogram) Count() int64 {
+	var n int64
+	for i := range s.values.counts {
+		n += int64(atomic.LoadUint64(&s.values.counts[i]))
+	}
+	return n
+}
+
+// Sum returns the sum of all observed values.
+func (s *bucketHistogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.values.sumBits))
+}
+
+// Buckets returns the upper bounds and the cumulative number of observations.
+func (s *bucketHistogram) Buckets() ([]float64, []int64) {
+	bounds := make([]float64, len(s.bounds))
+	copy(bounds, s.bounds)
+	return bounds, s.cumulative()
+}
+
+func (s *bucketHistogram) cumulative() []int64 {
+	counts := make([]int64, len(s.values.counts))
+	var n int64
+	for i := range s.values.counts {
+		n += int64(atomic.LoadUint64(&s.values.counts[i]))
+		counts[i] = n
+	}
+	return counts
+}
+
+// AddPoints adds points to be written to the db: the cumulative count of every bucket
+// tagged with its upper bound `le`, the sum and the count of the observations. They share
+// one field, so like the statistics of the sampled histogram all values are floats.
+func (s *bucketHistogram) AddPoints(pts []client.Point) []client.Point {
+	counts := s.cumulative()
+	for i, n := range counts {
+		pts = append(pts, getPoint(s.measurement, map[string]interface{}{s.fieldName: float64(n)}, s.leTags[i]))
+	}
+
+	pts = append(pts, getPoint(s.measurement, map[string]interface{}{s.fieldName: s.Sum()}, s.sumTags))
+	return append(pts, getPoint(s.measurement, map[string]interface{}{s.fieldName: float64(counts[len(counts)-1])}, s.countTags))
+}
+
+// rebind builds the tags of the points. The bucket tag of the sum and count keeps them apart from
+// the bucket counts like the statistics of the sampled histogram.
+func (s *bucketHistogram) rebind() {
+	s.leTags = make([]map[string]string, len(s.bounds))
+	for i, b := range s.bounds {
+		tags := make(map[string]string, len(s.tags)+1)
+		for k, v := range s.tags {
+			tags[k] = v
+		}
+		tags[leTag] = formatPromValue(b)
+		s.leTags[i] = tags
+	}
+	s.sumTags = bucketTags(sum, s.tags)
+	s.countTags = bucketTags(count, s.tags)
+	s.sender.bind(&s.baseMetric)
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearBuckets(t *testing.T) {
+	assert.Equal(t, []float64{1, 3, 5, 7}, LinearBuckets(1, 2, 4))
+	assert.Panics(t, func() { LinearBuckets(1, 0, 4) })
+	assert.Panics(t, func() { LinearBuckets(1, 1, 0) })
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	assert.Equal(t, []float64{0.5, 1, 2, 4}, ExponentialBuckets(0.5, 2, 4))
+	assert.Panics(t, func() { ExponentialBuckets(0, 2, 4) })
+	assert.Panics(t, func() { ExponentialBuckets(1, 1, 4) })
+}
+
+func TestNewBucketHistogram_bounds(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	bounds, counts := NewBucketHistogram("default", nil, WithReporter(rep)).Buckets()
+	assert.Equal(t, append(DefaultBuckets, math.Inf(1)), bounds)
+	assert.Len(t, counts, len(DefaultBuckets)+1)
+
+	bounds, _ = NewBucketHistogram("inf", []float64{1, math.Inf(1)}, WithReporter(rep)).Buckets()
+	assert.Equal(t, []float64{1, math.Inf(1)}, bounds)
+
+	assert.Panics(t, func() { NewBucketHistogram("unordered", []float64{2, 1}, WithReporter(rep)) })
+	assert.Panics(t, func() { NewBucketHistogram("nan", []float64{1, math.NaN()}, WithReporter(rep)) })
+}
+
+func Test_bucketHistogram_Observe(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+	h := NewBucketHistogram("latency", []float64{0.1, 0.5, 1}, WithReporter(rep))
+
+	var wg sync.WaitGroup
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 3, math.Inf(1)} {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			h.Observe(v)
+		}(v)
+	}
+	wg.Wait()
+
+	_, counts := h.Buckets()
+	assert.Equal(t, []int64{2, 3, 4, 6}, counts)
+	assert.Equal(t, int64(6), h.Count())
+	assert.True(t, math.IsInf(h.Sum(), 1))
+	assert.True(t, h == NewBucketHistogram("latency", nil, WithReporter(rep)))
+}
+
+func Test_bucketHistogram_AddPoints(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Tags(map[string]string{"host": "a"}))
+	h := NewBucketHistogram("latency", []float64{0.1, 1}, WithMeasurement("http"), WithReporter(rep))
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(0.7)
+
+	pts := h.(Metric).AddPoints(nil)
+	require.Len(t, pts, 5)
+	for _, pt := range pts {
+		assert.Equal(t, "http", pt.Measurement)
+		assert.Equal(t, "a", pt.Tags["host"])
+	}
+
+	assert.Equal(t, map[string]string{"host": "a", "le": "0.1"}, pts[0].Tags)
+	assert.Equal(t, 1.0, pts[0].Fields["latency.buckets"])
+	assert.Equal(t, map[string]string{"host": "a", "le": "1"}, pts[1].Tags)
+	assert.Equal(t, 3.0, pts[1].Fields["latency.buckets"])
+	assert.Equal(t, map[string]string{"host": "a", "le": "+Inf"}, pts[2].Tags)
+	assert.Equal(t, 3.0, pts[2].Fields["latency.buckets"])
+
+	assert.Equal(t, map[string]string{"host": "a", "bucket": "sum"}, pts[3].Tags)
+	assert.InDelta(t, 1.25, pts[3].Fields["latency.buckets"], 1e-9)
+	assert.Equal(t, map[string]string{"host": "a", "bucket": "count"}, pts[4].Tags)
+	assert.Equal(t, 3.0, pts[4].Fields["latency.buckets"])
+
+	// InfluxDB rejects values of different types in the same field
+	for _, pt := range pts {
+		for field, v := range pt.Fields {
+			assert.IsType(t, float64(0), v, field)
+		}
+	}
+	var lines string
+	for _, pt := range pts {
+		lines += pt.MarshalString() + "\n"
+	}
+	assert.NotContains(t, lines, "i\n", "no integer fields")
+	assert.Contains(t, lines, "http,bucket=count,host=a latency.buckets=3\n")
+}
+
+func Test_bucketHistogram_prometheus(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+	h := NewBucketHistogram("latency", []float64{0.1, 1}, WithReporter(rep), WithUnit("seconds"))
+	h.Observe(0.05)
+	h.Observe(2)
+
+	rec := httptest.NewRecorder()
+	rep.(PrometheusExporter).PrometheusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, `# TYPE default_latency_seconds histogram
+default_latency_seconds_bucket{le="0.1"} 1
+default_latency_seconds_bucket{le="1"} 1
+default_latency_seconds_bucket{le="+Inf"} 2
+default_latency_seconds_sum 2.05
+default_latency_seconds_count 2
+`, rec.Body.String())
+}
@@ -6,6 +6,8 @@ import (
 )
 
 // Counter implements go-metrics.Counter and possibly adds a bit functionality.
+// Counters are exported as monotonic counters to Prometheus and OTLP: Dec is not supported
+// for them and is seen as a counter reset. Use a gauge for values that can decrease.
 type Counter interface {
 	metrics.Counter
 }
@@ -25,15 +27,38 @@ func newCounter(name string, options ...Option) *counter {
 		Counter:    mtrx,
 		fieldName:  m.name + m.suffix,
 	}
+	if withStatsD(m) {
+		s := &statsdCounterMetric{Counter: mtrx}
+		s.bind(&t.baseMetric)
+		t.Counter = s
+	}
 	return m.register(t).(*counter)
 }
 
 type counter struct {
-	metrics.Counter
 	baseMetric
+	metrics.Counter
 	fieldName string
 }
 
+// Clear sets the counter to zero.
+func (s *counter) Clear() {
+	s.touch(s)
+	s.Counter.Clear()
+}
+
+// Dec decrements the counter by the given amount.
+func (s *counter) Dec(i int64) {
+	s.touch(s)
+	s.Counter.Dec(i)
+}
+
+// Inc increments the counter by the given amount.
+func (s *counter) Inc(i int64) {
+	s.touch(s)
+	s.Counter.Inc(i)
+}
+
 // AddPoints adds points to be written to the db.
 func (s *counter) AddPoints(pts []client.Point) []client.Point {
 	fields := map[string]interface{}{
@@ -25,6 +25,11 @@ func newGauge(name string, options ...Option) *gauge {
 		Gauge:      mtrx,
 		fieldName:  m.name + m.suffix,
 	}
+	if withStatsD(m) {
+		s := &statsdGaugeMetric{Gauge: mtrx}
+		s.bind(&t.baseMetric)
+		t.Gauge = s
+	}
 	return m.register(t).(*gauge)
 }
 
@@ -34,6 +39,12 @@ type gauge struct {
 	fieldName string
 }
 
+// Update updates the value of the gauge.
+func (s *gauge) Update(v int64) {
+	s.touch(s)
+	s.Gauge.Update(v)
+}
+
 // AddPoints adds points to be written to the db.
 func (s *gauge) AddPoints(pts []client.Point) []client.Point {
 	fields := map[string]interface{}{
@@ -25,6 +25,11 @@ func newGaugeFloat64(name string, options ...Option) *gaugeFloat64 {
 		GaugeFloat64: mtrx,
 		fieldName:    m.name + m.suffix,
 	}
+	if withStatsD(m) {
+		s := &statsdGaugeFloat64Metric{GaugeFloat64: mtrx}
+		s.bind(&t.baseMetric)
+		t.GaugeFloat64 = s
+	}
 	return m.register(t).(*gaugeFloat64)
 }
 
@@ -34,6 +39,12 @@ type gaugeFloat64 struct {
 	fieldName string
 }
 
+// Update updates the value of the gauge.
+func (s *gaugeFloat64) Update(v float64) {
+	s.touch(s)
+	s.GaugeFloat64.Update(v)
+}
+
 // AddPoints adds points to be written to the db.
 func (s *gaugeFloat64) AddPoints(pts []client.Point) []client.Point {
 	fields := map[string]interface{}{
@@ -24,19 +24,26 @@ func newHistogram(name string, options ...Option) *histogram {
 		baseMetric:  *m,
 		Histogram:   mtrx,
 		fieldName:   m.name + m.suffix,
+		exemplars:   &exemplarStore{},
 		percentiles: []float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999},
 		buckets: []string{count, max, mean, min, p50, p75, p95, p99, p999, p9999,
 			stddev, variance},
 	}
+	if withStatsD(m) {
+		s := &statsdHistogramMetric{Histogram: mtrx}
+		s.bind(&t.baseMetric)
+		t.Histogram = s
+	}
 	t.bucketTags = buildBucketTags(t.buckets, t.tags)
 	t.bucketVals = buildBucketVals(t.buckets, t.fieldName)
 	return m.register(t).(*histogram)
 }
 
 type histogram struct {
-	metrics.Histogram
 	baseMetric
+	metrics.Histogram
 	fieldName   string
+	exemplars   *exemplarStore
 	percentiles []float64
 	buckets     []string
 	bucketTags  map[string]map[string]string
@@ -86,3 +93,22 @@ func (s *histogram) AddPoints(pts []client.Point) []client.Point {
 	}
 	return pts
 }
+
+// Clear clears the sample of the histogram.
+func (s *histogram) Clear() {
+	s.touch(s)
+	s.Histogram.Clear()
+}
+
+// Update samples a new value.
+func (s *histogram) Update(v int64) {
+	s.touch(s)
+	s.Histogram.Update(v)
+}
+
+// UpdateWithExemplar samples a new value and keeps it as exemplar with the given labels
+// (e.g. `{"trace_id": "..."}`). Exemplars are exposed in the OpenMetrics format.
+func (s *histogram) UpdateWithExemplar(v int64, labels map[string]string) {
+	s.Update(v)
+	s.exemplars.store(float64(v), labels)
+}
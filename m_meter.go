@@ -19,12 +19,20 @@ func newMeter(name string, options ...Option) *meter {
 	if !ok {
 		mtrx = metrics.NewMeter()
 	}
+	restartable := newRestartMeter(mtrx)
+	mtrx = restartable
 
 	t := &meter{
-		baseMetric: *m,
-		Meter:      mtrx,
-		fieldName:  m.name + m.suffix,
-		buckets:    []string{count, m1, m5, m15, mean},
+		baseMetric:  *m,
+		Meter:       mtrx,
+		fieldName:   m.name + m.suffix,
+		buckets:     []string{count, m1, m5, m15, mean},
+		restartable: restartable,
+	}
+	if withStatsD(m) {
+		s := &statsdMeterMetric{Meter: mtrx}
+		s.bind(&t.baseMetric)
+		t.Meter = s
 	}
 	t.bucketTags = buildBucketTags(t.buckets, t.tags)
 	t.bucketVals = buildBucketVals(t.buckets, t.fieldName)
@@ -38,6 +46,14 @@ type meter struct {
 	buckets    []string
 	bucketTags map[string]map[string]string
 	bucketVals map[string]map[string]interface{}
+
+	restartable *restartMeter
+}
+
+// Mark records the occurrence of n events.
+func (s *meter) Mark(n int64) {
+	s.touch(s)
+	s.Meter.Mark(n)
 }
 
 // AddPoints adds points to be written to the db.
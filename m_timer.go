@@ -20,17 +20,28 @@ func newTimer(name string, options ...Option) *timer {
 
 	// was a metric provided? if not create new one.
 	mtrx, ok := m.metric.(metrics.Timer)
-	if !ok {
-		mtrx = metrics.NewTimer()
+	var restartable *restartTimer
+	if ok {
+		restartable = newRestartTimer(mtrx, nil)
+	} else {
+		restartable = newRestartTimer(nil, metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015)))
 	}
+	mtrx = restartable
 
 	t := &timer{
 		baseMetric:  *m,
 		Timer:       mtrx,
 		fieldName:   m.name + m.suffix,
+		exemplars:   &exemplarStore{},
 		percentiles: []float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999},
 		buckets: []string{count, max, mean, min, p50, p75, p95, p99, p999, p9999,
 			stddev, variance, m1, m5, m15, meanrate},
+		restartable: restartable,
+	}
+	if withStatsD(m) {
+		s := &statsdTimerMetric{Timer: mtrx}
+		s.bind(&t.baseMetric)
+		t.Timer = s
 	}
 	t.bucketTags = buildBucketTags(t.buckets, t.tags)
 	t.bucketVals = buildBucketVals(t.buckets, t.fieldName)
@@ -38,13 +49,16 @@ func newTimer(name string, options ...Option) *timer {
 }
 
 type timer struct {
-	metrics.Timer
 	baseMetric
+	metrics.Timer
 	fieldName   string
+	exemplars   *exemplarStore
 	percentiles []float64
 	buckets     []string
 	bucketTags  map[string]map[string]string
 	bucketVals  map[string]map[string]interface{}
+
+	restartable *restartTimer
 }
 
 // AddPoints adds points to be written to the db.
@@ -102,6 +116,25 @@ func getValue(bucket string, snapshot metrics.Timer, percentiles []float64) floa
 	return val
 }
 
+// Time records the duration of the execution of the given function.
+func (s *timer) Time(f func()) {
+	t := time.Now()
+	f()
+	s.Update(time.Since(t))
+}
+
+// Update records the duration of an event.
+func (s *timer) Update(d time.Duration) {
+	s.touch(s)
+	s.Timer.Update(d)
+}
+
+// UpdateSince records the duration of an event that started at the given time and ends now.
+func (s *timer) UpdateSince(ts time.Time) {
+	s.touch(s)
+	s.Timer.UpdateSince(ts)
+}
+
 // TimeThis measure starts a timer and returns a function to stop the time and report it.
 // Can be used as `defer timer.TimeThis()()`.
 func (s *timer) TimeThis() func() {
@@ -110,3 +143,10 @@ func (s *timer) TimeThis() func() {
 		s.UpdateSince(t)
 	}
 }
+
+// UpdateWithExemplar records the duration of an event and keeps it as exemplar with the given labels
+// (e.g. `{"trace_id": "..."}`). Exemplars are exposed in the OpenMetrics format.
+func (s *timer) UpdateWithExemplar(d time.Duration, labels map[string]string) {
+	s.Update(d)
+	s.exemplars.store(d.Seconds(), labels)
+}
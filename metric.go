@@ -5,9 +5,9 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"time"
 
 	client "github.com/influxdata/influxdb1-client"
-	"github.com/rcrowley/go-metrics"
 )
 
 const (
@@ -36,36 +36,84 @@ type metric interface {
 }
 
 func newMetric(name string, options ...Option) *baseMetric {
+	now := time.Now()
 	m := &baseMetric{
+		updated:     now.UnixNano(),
 		name:        name,
-		reporter:    defaultReporter,
 		measurement: "default",
 		suffix:      ".metric",
+		created:     now,
 		regMutex:    &sync.Mutex{},
 	}
 	for _, option := range options {
 		option(m)
 	}
+	if !m.reporterSet {
+		m.reporter = getDefaultReporter()
+	}
 	if m.reporter != nil {
-		m.tags = composeTags(m.reporter.Tags(), m.tags)
+		m.bind(m.reporter)
 	}
 	return m
 }
 
+// bind sets the reporter and applies its tags and settings.
+func (s *baseMetric) bind(r Reporter) {
+	s.reporter = r
+	s.tags = composeTags(r.Tags(), s.tags)
+
+	if rep, ok := r.(*reporter); ok {
+		if s.statsd == nil {
+			s.statsd = rep.statsd
+		}
+		if s.retentionPolicy != "" {
+			rep.setRetentionPolicy(s.measurement, s.retentionPolicy)
+		}
+	}
+}
+
 type baseMetric struct {
+	// updated is the time of the last update in unix nanoseconds, see reporter.expire. Accessed atomically: it is the first field to be 64-bit aligned, the
+	// metrics that can be children embed baseMetric as their first field.
+	updated int64
+
 	name string
 	incr int
 
 	metric interface{}
 
 	reporter    Reporter
+	reporterSet bool
 	measurement string
 	tags        map[string]string
 	suffix      string
+	unit        string
+	created     time.Time
+	statsd      *StatsDClient
+
+	retentionPolicy string
+	// standalone metrics are not registered, e.g. the children of a vector.
+	standalone bool
+
+	maxSeries        int
+	overflowBehavior CardinalityOverflow
+
+	// parent is the vector of a child, vecKey the key of the child in the vector.
+	parent *vec
+	vecKey string
+	// state tells whether the metric expired by TTL or was closed. Accessed atomically.
+	state int32
 
 	regMutex *sync.Mutex
 }
 
+// States of a metric regarding TTL, see reporter.expire.
+const (
+	stateActive int32 = iota
+	stateExpired
+	stateClosed
+)
+
 func (s *baseMetric) regName() string {
 	suffix := s.suffix
 	if s.incr != 0 {
@@ -78,21 +126,29 @@ func (s *baseMetric) regIncr() {
 }
 
 func (s *baseMetric) register(m metric) Metric {
+	if s.standalone {
+		return m.(Metric)
+	}
+
 	s.regMutex.Lock()
 	defer s.regMutex.Unlock()
+	bindMutex.Lock()
+	defer bindMutex.Unlock()
 
 	return s.reg(m)
 }
 func (s *baseMetric) reg(m metric) Metric {
-	regName := m.regName()
 	if s.reporter == nil {
-		log.Println("WARNING: no (default) metrics reporter set")
-		if err := metrics.Register(regName, m); err != nil {
-			log.Printf("default registry: metric could not be registered: %v", err)
+		// bound once a default reporter is set
+		var pending Metric
+		if s.reporter, pending = deferRegistration(m); s.reporter == nil {
+			return pending
 		}
-		return m
+		bind(m, s.reporter)
 	}
 
+	regName := m.regName()
+
 	if mtrx, ok := s.reporter.Get(regName); ok {
 		if reflect.TypeOf(m) == reflect.TypeOf(mtrx) {
 			return mtrx
@@ -108,8 +164,11 @@ func (s *baseMetric) reg(m metric) Metric {
 	return m
 }
 
+const unitSeconds = "seconds"
+
 const (
 	count    = "count"
+	sum      = "sum"
 	max      = "max"
 	mean     = "mean"
 	min      = "min"
@@ -126,3 +185,19 @@ const (
 	m15      = "m15"
 	meanrate = "meanrate"
 )
+
+// healthcheck is embedded by metrics that are not a metric type of go-metrics: its registries
+// only hold their own types, so those metrics register as health check that is always healthy.
+type healthcheck struct{}
+
+// Check implements go-metrics.Healthcheck.
+func (healthcheck) Check() {}
+
+// Error implements go-metrics.Healthcheck.
+func (healthcheck) Error() error { return nil }
+
+// Healthy implements go-metrics.Healthcheck.
+func (healthcheck) Healthy() {}
+
+// Unhealthy implements go-metrics.Healthcheck.
+func (healthcheck) Unhealthy(error) {}
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -14,6 +17,7 @@ type Option func(s *baseMetric)
 func WithReporter(r Reporter) Option {
 	return func(s *baseMetric) {
 		s.reporter = r
+		s.reporterSet = true
 	}
 }
 
@@ -31,6 +35,40 @@ func WithTags(t map[string]string) Option {
 	}
 }
 
+// WithUnit sets the unit of the metric (e.g. bytes). The unit is appended to the name
+// of the metric when exposed to Prometheus. Timers always use seconds.
+func WithUnit(unit string) Option {
+	return func(s *baseMetric) {
+		s.unit = unit
+	}
+}
+
+// WithStatsD sends every observation of the metric to StatsD.
+func WithStatsD(c *StatsDClient) Option {
+	return func(s *baseMetric) {
+		s.statsd = c
+	}
+}
+
+// WithRetentionPolicy writes the measurement of the metric to the given retention policy of
+// InfluxDB 1.x instead of the one of the reporter, e.g. high resolution data to a short one.
+// It applies to all metrics of the measurement, also to batches spooled to disk.
+func WithRetentionPolicy(rp string) Option {
+	return func(s *baseMetric) {
+		s.retentionPolicy = rp
+	}
+}
+
+// WithMaxSeries limits the number of series (combinations of label values) of a vector.
+// The values of further series go to the overflow series or are discarded.
+// The limit of the vector takes precedence over the one of the reporter.
+func WithMaxSeries(n int, overflow CardinalityOverflow) Option {
+	return func(s *baseMetric) {
+		s.maxSeries = n
+		s.overflowBehavior = overflow
+	}
+}
+
 // WithMetric injects a github.com/rcrowley/go-metrics metric instead of creating a new one.
 func WithMetric(m interface{}) Option {
 	return func(s *baseMetric) {
@@ -49,6 +87,66 @@ func Auth(user, pass string) ReporterOption {
 	}
 }
 
+// Timeout limits the time of a request to InfluxDB (default: DefaultInfluxTimeout).
+func Timeout(d time.Duration) ReporterOption {
+	return func(r *reporter) {
+		r.server.Timeout = d
+	}
+}
+
+// UserAgent sets the user agent sent to InfluxDB.
+func UserAgent(ua string) ReporterOption {
+	return func(r *reporter) {
+		r.server.UserAgent = ua
+	}
+}
+
+// CAFile verifies the certificate of InfluxDB with the PEM encoded CA bundle in the given file.
+func CAFile(path string) ReporterOption {
+	return func(r *reporter) {
+		r.server.CAFile = path
+	}
+}
+
+// ClientCert authenticates at InfluxDB with the PEM encoded client certificate and key in the given files.
+func ClientCert(certFile, keyFile string) ReporterOption {
+	return func(r *reporter) {
+		r.server.CertFile = certFile
+		r.server.KeyFile = keyFile
+	}
+}
+
+// InsecureSkipVerify disables the verification of the certificate of InfluxDB.
+func InsecureSkipVerify() ReporterOption {
+	return func(r *reporter) {
+		r.server.InsecureSkipVerify = true
+	}
+}
+
+// TLSConfig sets the TLS configuration of the connection to InfluxDB. CAFile, ClientCert
+// and InsecureSkipVerify are added to a copy of it.
+func TLSConfig(conf *tls.Config) ReporterOption {
+	return func(r *reporter) {
+		r.server.TLS = conf
+	}
+}
+
+// Proxy connects to InfluxDB via the given proxy. By default the proxy is taken from the
+// environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+func Proxy(proxyURL *url.URL) ReporterOption {
+	return func(r *reporter) {
+		r.server.Proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// HTTPClient sets the client used for the requests to InfluxDB. Timeout, TLS and proxy
+// options are ignored then.
+func HTTPClient(c *http.Client) ReporterOption {
+	return func(r *reporter) {
+		r.server.HTTPClient = c
+	}
+}
+
 // Interval overwrites the default interval of 10 seconds. The interval is used to send
 // the data e.g. every 10 seconds.
 func Interval(d time.Duration) ReporterOption {
@@ -92,8 +190,213 @@ func WithMemStats() ReporterOption {
 	}
 }
 
+// UDPPayloadSize sets the maximum size of the packets when writing to InfluxDB via UDP.
+// The batches are split into packets of this size. Defaults to 512 bytes.
+func UDPPayloadSize(size int) ReporterOption {
+	return func(r *reporter) {
+		r.server.PayloadSize = size
+	}
+}
+
+// StatsD sends the observations of all metrics created with this reporter to StatsD.
+func StatsD(c *StatsDClient) ReporterOption {
+	return func(r *reporter) {
+		r.statsd = c
+	}
+}
+
+// WithSink sends the collected data to the given sink instead of InfluxDB.
+// It can be given multiple times to send the data to several sinks concurrently.
+func WithSink(sink Sink, options ...SinkOption) ReporterOption {
+	return func(r *reporter) {
+		r.sinks = append(r.sinks, newSinkWorker(sink, options...))
+	}
+}
+
+// WithLogger sets the logger the errors of the reporter and its sinks are written to.
+// By default they are written with the standard log package.
+func WithLogger(l Logger) ReporterOption {
+	return func(r *reporter) {
+		r.logger = l
+	}
+}
+
+// OnWriteError sets a callback for failed writes to a sink with the error and the number of points of the batch.
+// Like all callbacks it is called from the go routines of the sinks and must not block.
+func OnWriteError(f func(err error, points int)) ReporterOption {
+	return func(r *reporter) {
+		r.hooks.onWriteError = f
+	}
+}
+
+// OnReconnect sets a callback for a sink answering a ping again after a failed ping.
+// The index of the sink is passed in the order the sinks were added to the reporter.
+func OnReconnect(f func(sink int)) ReporterOption {
+	return func(r *reporter) {
+		r.hooks.onReconnect = f
+	}
+}
+
+// OnPingError sets a callback for failed pings of a sink.
+func OnPingError(f func(err error)) ReporterOption {
+	return func(r *reporter) {
+		r.hooks.onPingError = f
+	}
+}
+
+// OnDroppedPoints sets a callback for data points dropped because they could not be written.
+// If a sink is still busy with previous batches it is called from the go routine running the
+// reporter, otherwise from the go routine of the sink.
+func OnDroppedPoints(f func(points int)) ReporterOption {
+	return func(r *reporter) {
+		r.hooks.onDrop = f
+	}
+}
+
+// OnFlush sets a callback called after every write of a batch to a sink.
+func OnFlush(f func(stats FlushStats)) ReporterOption {
+	return func(r *reporter) {
+		r.hooks.onFlush = f
+	}
+}
+
+// SelfMetrics registers metrics about the reporter itself to its registry: written points,
+// batches and bytes, write latency, errors, dropped points, retry queue depth and ping round
+// trip time per sink (named `sink<n>.<metric>`) and the time it takes to collect the data points.
+// They are reported under the given measurement, DefaultSelfMeasurement if empty.
+func SelfMetrics(measurement string) ReporterOption {
+	return func(r *reporter) {
+		if measurement == "" {
+			measurement = DefaultSelfMeasurement
+		}
+		r.selfName = measurement
+	}
+}
+
+// SinkOption defines an option to be used when adding a sink to a reporter.
+type SinkOption func(w *sinkWorker)
+
+// SinkTimeout sets the time a sink has to write a batch. Defaults to the interval of the reporter.
+func SinkTimeout(d time.Duration) SinkOption {
+	return func(w *sinkWorker) {
+		w.timeout = d
+	}
+}
+
+// OnSinkError sets a handler for errors of the sink. By default errors are logged.
+func OnSinkError(handler func(err error)) SinkOption {
+	return func(w *sinkWorker) {
+		w.onError = handler
+	}
+}
+
+// SinkRetry buffers the batches the sink failed to write and retries them with exponential backoff.
+func SinkRetry(conf RetryConfig) SinkOption {
+	return func(w *sinkWorker) {
+		w.retry = newRetryBuffer(conf)
+	}
+}
+
+// Retry buffers failed writes of all sinks of the reporter and retries them with exponential backoff.
+// Sinks added with their own SinkRetry option keep their configuration.
+func Retry(conf RetryConfig) ReporterOption {
+	return func(r *reporter) {
+		r.retry = &conf
+	}
+}
+
+// SinkSpool spools the batches the sink failed to write to disk and writes them once the sink is
+// reachable again. Combined with SinkRetry only batches dropped from the retry buffer are spooled.
+func SinkSpool(conf SpoolConfig) SinkOption {
+	return func(w *sinkWorker) {
+		w.spoolConf = &conf
+	}
+}
+
+// Spool spools failed writes of all sinks of the reporter to disk. Every sink gets its own
+// sub directory `sink-<n>` (numbered in the order the sinks were added). Sinks added with
+// their own SinkSpool option keep their configuration.
+func Spool(conf SpoolConfig) ReporterOption {
+	return func(r *reporter) {
+		r.spool = &conf
+	}
+}
+
+// MaxSeries limits the number of series of all vectors of the reporter together. The values of
+// further series go to the overflow series of their vector or are discarded. Rejected series are
+// counted in Status and a warning is logged once per vector.
+func MaxSeries(n int, overflow CardinalityOverflow) ReporterOption {
+	return func(r *reporter) {
+		r.maxSeries = n
+		r.overflow = overflow
+	}
+}
+
+// TTL removes the metrics and children of vectors not updated for the given number of intervals,
+// e.g. of short-lived tenants or jobs. Gauges set once, e.g. to a version, expire as well.
+// A metric the caller still holds is reported again with its next update.
+func TTL(intervals int) ReporterOption {
+	return func(r *reporter) {
+		r.ttl = intervals
+	}
+}
+
+// MaxBatchPoints splits the batches into chunks of at most n data points before they are
+// written to the sinks. Useful if a sink rejects large requests. See WriteConcurrency.
+func MaxBatchPoints(n int) ReporterOption {
+	return func(r *reporter) {
+		r.chunking.maxPoints = n
+	}
+}
+
+// MaxBatchBytes splits the batches into chunks of at most n bytes in line protocol before they
+// are written to the sinks. A data point larger than n is written on its own.
+func MaxBatchBytes(n int) ReporterOption {
+	return func(r *reporter) {
+		r.chunking.maxBytes = n
+	}
+}
+
+// WriteConcurrency sets how many chunks of a batch are written to a sink at the same time (default: 1).
+// The sinks must then support concurrent writes, which the InfluxDB sinks do.
+// Errors of the chunks are returned as *ChunkError.
+func WriteConcurrency(n int) ReporterOption {
+	return func(r *reporter) {
+		r.chunking.concurrency = n
+	}
+}
+
+// RetentionPolicy writes to the given retention policy of InfluxDB 1.x instead of the default one.
+func RetentionPolicy(rp string) ReporterOption {
+	return func(r *reporter) {
+		r.server.RetentionPolicy = rp
+	}
+}
+
+// WriteConsistency sets the write consistency (any, one, quorum or all) of an InfluxDB Enterprise cluster.
+func WriteConsistency(c string) ReporterOption {
+	return func(r *reporter) {
+		r.server.WriteConsistency = c
+	}
+}
+
 func withDBClient(client dbClient) ReporterOption {
 	return func(r *reporter) {
 		r.client = client
 	}
 }
+
+// Gzip enables gzip compression of the data sent to InfluxDB 2.x.
+func Gzip() ReporterOption {
+	return func(r *reporter) {
+		r.server.Gzip = true
+	}
+}
+
+// Precision sets the precision (ns, us, ms or s) of the timestamps sent to InfluxDB.
+// Defaults to ns.
+func Precision(p string) ReporterOption {
+	return func(r *reporter) {
+		r.server.Precision = p
+	}
+}
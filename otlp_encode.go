@@ -0,0 +1,291 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// otlpScope is the name of the instrumentation scope the metrics are reported under.
+const otlpScope = "github.com/tehsphinx/metrics"
+
+// aggregationTemporality CUMULATIVE of the OTLP metrics data model.
+const otlpCumulative = 2
+
+// marshalJSON encodes the export as OTLP/JSON ExportMetricsServiceRequest.
+// As defined by the protobuf JSON mapping 64 bit integers are encoded as strings.
+func (e otlpExport) marshalJSON() []byte {
+	metrics := make([]map[string]interface{}, 0, len(e.metrics))
+	for _, m := range e.metrics {
+		points := make([]map[string]interface{}, 0, len(m.points))
+		for _, dp := range m.points {
+			points = append(points, dp.jsonValue(m.kind))
+		}
+
+		metric := map[string]interface{}{"name": m.name}
+		if m.unit != "" {
+			metric["unit"] = m.unit
+		}
+		switch m.kind {
+		case otlpGauge:
+			metric["gauge"] = map[string]interface{}{"dataPoints": points}
+		case otlpSum:
+			metric["sum"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": otlpCumulative,
+				"isMonotonic":            true,
+			}
+		case otlpSummary:
+			metric["summary"] = map[string]interface{}{"dataPoints": points}
+		case otlpHistogram:
+			metric["histogram"] = map[string]interface{}{
+				"dataPoints":             points,
+				"aggregationTemporality": otlpCumulative,
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	req := map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": otlpJSONAttributes(e.resource)},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]interface{}{"name": otlpScope},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+
+	// the values are plain maps, slices, strings and numbers: marshalling cannot fail
+	b, _ := json.Marshal(req)
+	return b
+}
+
+func (dp *otlpDataPoint) jsonValue(kind int) map[string]interface{} {
+	v := map[string]interface{}{
+		"attributes":        otlpJSONAttributes(dp.attributes),
+		"startTimeUnixNano": strconv.FormatInt(dp.start, 10),
+		"timeUnixNano":      strconv.FormatInt(dp.time, 10),
+	}
+	if kind == otlpHistogram {
+		bounds := make([]interface{}, 0, len(dp.buckets))
+		counts := make([]string, 0, len(dp.buckets))
+		for i, b := range dp.buckets {
+			// the last bucket has no upper bound: it is +Inf
+			if i < len(dp.buckets)-1 {
+				bounds = append(bounds, otlpJSONFloat(b.bound))
+			}
+			counts = append(counts, strconv.FormatUint(b.count, 10))
+		}
+		v["count"] = strconv.FormatUint(dp.count, 10)
+		v["sum"] = otlpJSONFloat(dp.sum)
+		v["bucketCounts"] = counts
+		v["explicitBounds"] = bounds
+		return v
+	}
+	if kind != otlpSummary {
+		v["asDouble"] = otlpJSONFloat(dp.value)
+		return v
+	}
+
+	quantiles := make([]map[string]interface{}, 0, len(dp.quantiles))
+	for _, q := range dp.quantiles {
+		quantiles = append(quantiles, map[string]interface{}{
+			"quantile": q.quantile,
+			"value":    otlpJSONFloat(q.value),
+		})
+	}
+	v["count"] = strconv.FormatUint(dp.count, 10)
+	v["sum"] = otlpJSONFloat(dp.sum)
+	v["quantileValues"] = quantiles
+	return v
+}
+
+func otlpJSONAttributes(attrs []otlpAttribute) []map[string]interface{} {
+	kvs := make([]map[string]interface{}, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, map[string]interface{}{
+			"key":   a.key,
+			"value": map[string]string{"stringValue": a.value},
+		})
+	}
+	return kvs
+}
+
+// otlpJSONFloat encodes NaN and infinity as strings as JSON does not support them.
+func otlpJSONFloat(v float64) interface{} {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+	return v
+}
+
+// marshalProto encodes the export as OTLP ExportMetricsServiceRequest in the protobuf wire format.
+func (e otlpExport) marshalProto() []byte {
+	var resource protoBuffer
+	for _, a := range e.resource {
+		resource.message(1, otlpProtoAttribute(a))
+	}
+
+	var scope protoBuffer
+	scope.string(1, otlpScope)
+
+	var scopeMetrics protoBuffer
+	scopeMetrics.message(1, scope.b)
+	for _, m := range e.metrics {
+		scopeMetrics.message(2, m.marshalProto())
+	}
+
+	var resourceMetrics protoBuffer
+	resourceMetrics.message(1, resource.b)
+	resourceMetrics.message(2, scopeMetrics.b)
+
+	var req protoBuffer
+	req.message(1, resourceMetrics.b)
+	return req.b
+}
+
+func (m *otlpMetric) marshalProto() []byte {
+	var data protoBuffer
+	for _, dp := range m.points {
+		data.message(1, dp.marshalProto(m.kind))
+	}
+
+	var metric protoBuffer
+	metric.string(1, m.name)
+	if m.unit != "" {
+		metric.string(3, m.unit)
+	}
+	switch m.kind {
+	case otlpGauge:
+		metric.message(5, data.b)
+	case otlpSum:
+		data.varint(2, otlpCumulative)
+		data.varint(3, 1) // is_monotonic
+		metric.message(7, data.b)
+	case otlpSummary:
+		metric.message(11, data.b)
+	case otlpHistogram:
+		data.varint(2, otlpCumulative)
+		metric.message(9, data.b)
+	}
+	return metric.b
+}
+
+// marshalProto encodes a NumberDataPoint, SummaryDataPoint or HistogramDataPoint.
+func (dp *otlpDataPoint) marshalProto(kind int) []byte {
+	var p protoBuffer
+	p.fixed64(2, uint64(dp.start))
+	p.fixed64(3, uint64(dp.time))
+
+	switch kind {
+	case otlpHistogram:
+		p.fixed64(4, dp.count)
+		p.double(5, dp.sum)
+
+		var counts, bounds protoBuffer
+		for i, b := range dp.buckets {
+			// the last bucket has no upper bound: it is +Inf
+			if i < len(dp.buckets)-1 {
+				bounds.appendFixed64(math.Float64bits(b.bound))
+			}
+			counts.appendFixed64(b.count)
+		}
+		p.message(6, counts.b) // packed bucket_counts
+		p.message(7, bounds.b) // packed explicit_bounds
+
+		// other than the other data points the histogram has its attributes in field 9
+		for _, a := range dp.attributes {
+			p.message(9, otlpProtoAttribute(a))
+		}
+		return p.b
+	case otlpSummary:
+		p.fixed64(4, dp.count)
+		p.double(5, dp.sum)
+		for _, q := range dp.quantiles {
+			var vq protoBuffer
+			vq.double(1, q.quantile)
+			vq.double(2, q.value)
+			p.message(6, vq.b)
+		}
+	default:
+		p.double(4, dp.value)
+	}
+
+	for _, a := range dp.attributes {
+		p.message(7, otlpProtoAttribute(a))
+	}
+	return p.b
+}
+
+func otlpProtoAttribute(a otlpAttribute) []byte {
+	var value protoBuffer
+	value.string(1, a.value)
+
+	var kv protoBuffer
+	kv.string(1, a.key)
+	kv.message(2, value.b)
+	return kv.b
+}
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// protoBuffer appends fields in the protobuf wire format.
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) key(field, wireType int) {
+	p.b = appendUvarint(p.b, uint64(field<<3|wireType))
+}
+
+func (p *protoBuffer) varint(field int, v uint64) {
+	p.key(field, protoVarint)
+	p.b = appendUvarint(p.b, v)
+}
+
+func (p *protoBuffer) fixed64(field int, v uint64) {
+	p.key(field, protoFixed64)
+	p.appendFixed64(v)
+}
+
+// appendFixed64 appends a value without key, e.g. to a packed repeated field.
+func (p *protoBuffer) appendFixed64(v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	p.b = append(p.b, buf[:]...)
+}
+
+func (p *protoBuffer) double(field int, v float64) {
+	p.fixed64(field, math.Float64bits(v))
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	p.message(field, []byte(s))
+}
+
+func (p *protoBuffer) message(field int, b []byte) {
+	p.key(field, protoBytes)
+	p.b = appendUvarint(p.b, uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
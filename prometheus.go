@@ -0,0 +1,460 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	promTypeCounter   = "counter"
+	promTypeGauge     = "gauge"
+	promTypeSummary   = "summary"
+	promTypeHistogram = "histogram"
+	promTypeUntyped   = "untyped"
+	promTypeUnknown   = "unknown"
+
+	promContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var promQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999}
+
+// promHandler renders the metrics of a registry in the Prometheus text exposition format
+// or in the OpenMetrics format if the client accepts it.
+type promHandler struct {
+	registry metrics.Registry
+}
+
+// ServeHTTP collects all metrics of the registry and writes them to the response.
+func (h promHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := newPromCollector(acceptsOpenMetrics(req.Header.Get("Accept")))
+	c.collect(h.registry)
+
+	if c.openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", promContentType)
+	}
+	_, _ = w.Write(c.bytes())
+}
+
+// acceptsOpenMetrics checks if the Accept header of a scrape request asks for the OpenMetrics format.
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		if mediaType == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promSample struct {
+	name     string
+	labels   []promLabel
+	value    float64
+	exemplar *exemplar
+}
+
+type promFamily struct {
+	name    string
+	typ     string
+	unit    string
+	samples []promSample
+}
+
+// promCollector groups the samples of all metrics into metric families.
+type promCollector struct {
+	openMetrics bool
+	families    map[string]*promFamily
+}
+
+func newPromCollector(openMetrics bool) *promCollector {
+	return &promCollector{
+		openMetrics: openMetrics,
+		families:    make(map[string]*promFamily),
+	}
+}
+
+func (c *promCollector) collect(registry metrics.Registry) {
+	var names []string
+	registry.Each(func(name string, _ interface{}) {
+		names = append(names, name)
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		if data := registry.Get(name); data != nil {
+			c.add(name, data)
+		}
+	}
+}
+
+func (c *promCollector) add(name string, data interface{}) {
+	switch m := data.(type) {
+	case *counter:
+		c.counter(&m.baseMetric, m.Count())
+	case *gauge:
+		c.gauge(&m.baseMetric, float64(m.Value()))
+	case *gaugeFloat64:
+		c.gauge(&m.baseMetric, m.Value())
+	case *meter:
+		c.meter(&m.baseMetric, m.Snapshot())
+	case *timer:
+		ms := m.Snapshot()
+		c.timer(&m.baseMetric, ms)
+		c.observations(&m.baseMetric, ms.Count(), m.exemplars.load())
+	case *bucketHistogram:
+		c.bucketHistogram(m)
+	case *histogram:
+		ms := m.Snapshot()
+		c.histogram(&m.baseMetric, ms)
+		c.observations(&m.baseMetric, ms.Count(), m.exemplars.load())
+	case vecMetric:
+		m.each(func(child Metric) {
+			c.add(name, child)
+		})
+	case Metric:
+		c.points(m.AddPoints(nil))
+	case metrics.Counter:
+		c.counter(rawMetric(name), m.Count())
+	case metrics.Gauge:
+		c.gauge(rawMetric(name), float64(m.Value()))
+	case metrics.GaugeFloat64:
+		c.gauge(rawMetric(name), m.Value())
+	case metrics.Meter:
+		c.meter(rawMetric(name), m.Snapshot())
+	case metrics.Timer:
+		c.timer(rawMetric(name), m.Snapshot())
+	case metrics.Histogram:
+		c.histogram(rawMetric(name), m.Snapshot())
+	}
+}
+
+// rawMetric describes a go-metrics metric registered without this package.
+func rawMetric(name string) *baseMetric {
+	return &baseMetric{
+		name:        name,
+		measurement: "default",
+	}
+}
+
+func (c *promCollector) counter(m *baseMetric, count int64) {
+	c.total(promName(m.measurement, m.name, m.unit), m, float64(count), nil)
+}
+
+// total adds the sample of a counter. The Prometheus format names the family after the sample
+// (`name_total`) while OpenMetrics uses the name without suffix and adds the creation time.
+func (c *promCollector) total(name string, m *baseMetric, value float64, ex *exemplar) {
+	name = strings.TrimSuffix(name, "_total")
+
+	family := name
+	if !c.openMetrics {
+		family += "_total"
+	}
+	f := c.family(family, promTypeCounter, m.unit)
+	f.samples = append(f.samples, promSample{
+		name:     name + "_total",
+		labels:   promLabels(m.tags),
+		value:    value,
+		exemplar: ex,
+	})
+	c.created(f, name, m)
+}
+
+// created adds the creation time of a counter or summary. It is only part of the OpenMetrics format.
+func (c *promCollector) created(f *promFamily, name string, m *baseMetric) {
+	if !c.openMetrics || m.created.IsZero() {
+		return
+	}
+	f.samples = append(f.samples, promSample{
+		name:   name + "_created",
+		labels: promLabels(m.tags),
+		value:  float64(m.created.UnixNano()) / 1e9,
+	})
+}
+
+func (c *promCollector) gauge(m *baseMetric, value float64) {
+	name := promName(m.measurement, m.name, m.unit)
+	c.sample(c.family(name, promTypeGauge, m.unit), name, m.tags, value)
+}
+
+func (c *promCollector) meter(m *baseMetric, ms metrics.Meter) {
+	c.total(promName(m.measurement, m.name, ""), m, float64(ms.Count()), nil)
+	c.rates(promName(m.measurement, m.name, ""), m.tags, ms)
+}
+
+// rater is implemented by meters and timers.
+type rater interface {
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+}
+
+func (c *promCollector) rates(name string, tags map[string]string, ms rater) {
+	c.gaugeSample(name+"_rate1", tags, ms.Rate1())
+	c.gaugeSample(name+"_rate5", tags, ms.Rate5())
+	c.gaugeSample(name+"_rate15", tags, ms.Rate15())
+	c.gaugeSample(name+"_rate_mean", tags, ms.RateMean())
+}
+
+// timer reports the durations in seconds as the Prometheus conventions recommend.
+func (c *promCollector) timer(m *baseMetric, ms metrics.Timer) {
+	var (
+		name  = promName(m.measurement, m.name, unitSeconds)
+		scale = 1 / float64(1e9)
+	)
+
+	c.summary(name, unitSeconds, m, ms.Percentiles(promQuantiles), ms.Count(), ms.Mean(), scale)
+	c.stats(name, m.tags, float64(ms.Min()), float64(ms.Max()), ms.Mean(), ms.StdDev(), scale)
+	c.rates(name, m.tags, ms)
+}
+
+func (c *promCollector) histogram(m *baseMetric, ms metrics.Histogram) {
+	name := promName(m.measurement, m.name, m.unit)
+
+	c.summary(name, m.unit, m, ms.Percentiles(promQuantiles), ms.Count(), ms.Mean(), 1)
+	c.stats(name, m.tags, float64(ms.Min()), float64(ms.Max()), ms.Mean(), ms.StdDev(), 1)
+}
+
+// bucketHistogram adds the cumulative bucket counts, sum and count of a histogram with fixed buckets.
+func (c *promCollector) bucketHistogram(m *bucketHistogram) {
+	var (
+		name   = promName(m.measurement, m.name, m.unit)
+		f      = c.family(name, promTypeHistogram, m.unit)
+		counts = m.cumulative()
+	)
+
+	for i, bound := range m.bounds {
+		c.sample(f, name+"_bucket", m.tags, float64(counts[i]), promLabel{
+			name:  leTag,
+			value: formatPromValue(bound),
+		})
+	}
+	c.sample(f, name+"_sum", m.tags, m.Sum())
+	c.sample(f, name+"_count", m.tags, float64(counts[len(counts)-1]))
+	c.created(f, name, &m.baseMetric)
+}
+
+// observations exposes the number of observations of a timer or histogram as counter carrying the
+// latest exemplar. OpenMetrics only allows exemplars on counters and histogram buckets, so it is
+// not part of the Prometheus format.
+func (c *promCollector) observations(m *baseMetric, count int64, ex *exemplar) {
+	if !c.openMetrics {
+		return
+	}
+	c.total(promName(m.measurement, m.name, "")+"_observations", &baseMetric{
+		tags:    m.tags,
+		created: m.created,
+	}, float64(count), ex)
+}
+
+// summary adds the quantiles, sum and count of a sampled metric. The sum is estimated from the
+// mean of the sample since the sample itself does not hold all observed values.
+func (c *promCollector) summary(name, unit string, m *baseMetric, ps []float64, count int64, mean, scale float64) {
+	f := c.family(name, promTypeSummary, unit)
+	for i, q := range promQuantiles {
+		c.sample(f, name, m.tags, ps[i]*scale, promLabel{
+			name:  "quantile",
+			value: formatPromValue(q),
+		})
+	}
+	c.sample(f, name+"_sum", m.tags, mean*float64(count)*scale)
+	c.sample(f, name+"_count", m.tags, float64(count))
+	c.created(f, name, m)
+}
+
+func (c *promCollector) stats(name string, tags map[string]string, min, max, mean, stddev, scale float64) {
+	c.gaugeSample(name+"_min", tags, min*scale)
+	c.gaugeSample(name+"_max", tags, max*scale)
+	c.gaugeSample(name+"_mean", tags, mean*scale)
+	c.gaugeSample(name+"_stddev", tags, stddev*scale)
+}
+
+// points adds the data points of a custom metric. Every numeric field becomes an untyped sample.
+func (c *promCollector) points(pts []client.Point) {
+	typ := promTypeUntyped
+	if c.openMetrics {
+		typ = promTypeUnknown
+	}
+
+	for _, pt := range pts {
+		fields := make([]string, 0, len(pt.Fields))
+		for field := range pt.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			value, ok := floatValue(pt.Fields[field])
+			if !ok {
+				continue
+			}
+			name := promName(pt.Measurement, field, "")
+			c.sample(c.family(name, typ, ""), name, pt.Tags, value)
+		}
+	}
+}
+
+func (c *promCollector) gaugeSample(name string, tags map[string]string, value float64) {
+	c.sample(c.family(name, promTypeGauge, ""), name, tags, value)
+}
+
+// family returns the metric family with the given name. It is created if it does not exist yet.
+// The unit is only kept if the name ends with it as OpenMetrics requires.
+func (c *promCollector) family(name, typ, unit string) *promFamily {
+	f, ok := c.families[name]
+	if ok {
+		return f
+	}
+
+	f = &promFamily{name: name, typ: typ}
+	if unit != "" && strings.HasSuffix(name, "_"+unit) {
+		f.unit = unit
+	}
+	c.families[name] = f
+	return f
+}
+
+func (c *promCollector) sample(f *promFamily, name string, tags map[string]string, value float64, extra ...promLabel) {
+	f.samples = append(f.samples, promSample{
+		name:   name,
+		labels: append(promLabels(tags), extra...),
+		value:  value,
+	})
+}
+
+func (c *promCollector) bytes() []byte {
+	names := make([]string, 0, len(c.families))
+	for name := range c.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		f := c.families[name]
+		b.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		if c.openMetrics && f.unit != "" {
+			b.WriteString("# UNIT " + f.name + " " + f.unit + "\n")
+		}
+		for _, s := range f.samples {
+			writePromSample(&b, s)
+		}
+	}
+	if c.openMetrics {
+		b.WriteString("# EOF\n")
+	}
+	return b.Bytes()
+}
+
+func writePromSample(b *bytes.Buffer, s promSample) {
+	b.WriteString(s.name)
+	writePromLabels(b, s.labels)
+	b.WriteByte(' ')
+	b.WriteString(formatPromValue(s.value))
+
+	if e := s.exemplar; e != nil {
+		b.WriteString(" # ")
+		if len(e.labels) == 0 {
+			b.WriteString("{}")
+		}
+		writePromLabels(b, promLabels(e.labels))
+		b.WriteByte(' ')
+		b.WriteString(formatPromValue(e.value))
+		b.WriteByte(' ')
+		b.WriteString(formatPromValue(float64(e.time.UnixNano()) / 1e9))
+	}
+	b.WriteByte('\n')
+}
+
+func writePromLabels(b *bytes.Buffer, labels []promLabel) {
+	if len(labels) == 0 {
+		return
+	}
+
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name + `="` + escapePromLabel(l.value) + `"`)
+	}
+	b.WriteByte('}')
+}
+
+func promLabels(tags map[string]string) []promLabel {
+	labels := make([]promLabel, 0, len(tags)+1)
+	for k, v := range tags {
+		labels = append(labels, promLabel{name: promLabelName(k), value: v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	return labels
+}
+
+// promName builds a valid Prometheus metric name from the measurement, the metric name and its unit.
+func promName(measurement, name, unit string) string {
+	n := sanitizeProm(measurement+"_"+name, true)
+	if unit == "" || strings.HasSuffix(n, "_"+unit) {
+		return n
+	}
+	return n + "_" + sanitizeProm(unit, false)
+}
+
+func promLabelName(name string) string {
+	return sanitizeProm(name, false)
+}
+
+// sanitizeProm replaces all characters not allowed in Prometheus names by an underscore.
+// Colons are only allowed in metric names.
+func sanitizeProm(name string, colon bool) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', colon && r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapePromLabel(value string) string {
+	return promLabelEscaper.Replace(value)
+}
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type custPoints struct {
+	metrics.Gauge
+}
+
+func (s custPoints) AddPoints(pts []client.Point) []client.Point {
+	return append(pts, getPoint("cust.measure", map[string]interface{}{"value": 3, "text": "skipped"},
+		map[string]string{"host": "a\"b"}))
+}
+
+func Test_reporter_PrometheusHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	r := NewReporter("", "", Registry(reg), Tags(map[string]string{"app": "test"}))
+
+	NewCounter("requests", WithReporter(r), WithMeasurement("http"),
+		WithTags(map[string]string{"status-code": "200"})).Inc(5)
+	NewGauge("queue", WithReporter(r), WithMeasurement("http")).Update(7)
+	NewGaugeFloat64("load", WithReporter(r)).Update(0.5)
+	NewMeter("events", WithReporter(r)).Mark(3)
+	NewTimer("latency", WithReporter(r), WithMeasurement("http")).(TimerExemplarUpdater).
+		UpdateWithExemplar(2*time.Second, map[string]string{"trace_id": "abc123"})
+	NewHistogram("size", WithReporter(r)).Update(10)
+	if err := r.Register("custom", custPoints{Gauge: metrics.NewGauge()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("raw", metrics.NewCounter()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.(PrometheusExporter).PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, promContentType, rec.Header().Get("Content-Type"))
+	body, _ := ioutil.ReadAll(rec.Body)
+	out := string(body)
+
+	for _, line := range []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{app="test",status_code="200"} 5` + "\n",
+		"# TYPE http_queue gauge\n",
+		`http_queue{app="test"} 7` + "\n",
+		`default_load{app="test"} 0.5` + "\n",
+		"# TYPE default_events_total counter\n",
+		`default_events_total{app="test"} 3` + "\n",
+		"# TYPE default_events_rate1 gauge\n",
+		"# TYPE http_latency_seconds summary\n",
+		`http_latency_seconds{app="test",quantile="0.5"} 2` + "\n",
+		`http_latency_seconds_sum{app="test"} 2` + "\n",
+		`http_latency_seconds_count{app="test"} 1` + "\n",
+		`http_latency_seconds_max{app="test"} 2` + "\n",
+		"# TYPE default_size summary\n",
+		`default_size{app="test",quantile="0.99"} 10` + "\n",
+		"# TYPE cust_measure_value untyped\n",
+		`cust_measure_value{host="a\"b"} 3` + "\n",
+		"# TYPE default_raw_total counter\n",
+		"default_raw_total 0\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+	assert.NotContains(t, out, "text")
+}
+
+func Test_sanitizeProm(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		colon bool
+		want  string
+	}{
+		{name: "valid", in: "foo_bar:baz", colon: true, want: "foo_bar:baz"},
+		{name: "label without colon", in: "foo:bar", want: "foo_bar"},
+		{name: "dots and dashes", in: "foo.bar-baz", colon: true, want: "foo_bar_baz"},
+		{name: "leading digit", in: "1foo", want: "_1foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeProm(tt.in, tt.colon))
+		})
+	}
+}
+
+func Test_reporter_PrometheusHandler_openMetrics(t *testing.T) {
+	r := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	NewCounter("requests", WithReporter(r), WithMeasurement("http")).Inc(5)
+	NewGauge("heap", WithReporter(r), WithUnit("bytes")).Update(1024)
+	NewTimer("latency", WithReporter(r), WithMeasurement("http")).(TimerExemplarUpdater).
+		UpdateWithExemplar(500*time.Millisecond, map[string]string{"trace_id": "abc123"})
+	NewHistogram("size", WithReporter(r)).Update(10)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	rec := httptest.NewRecorder()
+	r.(PrometheusExporter).PrometheusHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, openMetricsContentType, rec.Header().Get("Content-Type"))
+	body, _ := ioutil.ReadAll(rec.Body)
+	out := string(body)
+
+	for _, line := range []string{
+		"# TYPE http_requests counter\n",
+		"http_requests_total 5\n",
+		"http_requests_created ",
+		"# TYPE default_heap_bytes gauge\n# UNIT default_heap_bytes bytes\n",
+		"default_heap_bytes 1024\n",
+		"# TYPE http_latency_seconds summary\n# UNIT http_latency_seconds seconds\n",
+		`http_latency_seconds{quantile="0.5"} 0.5` + "\n",
+		"http_latency_seconds_created ",
+		"# TYPE http_latency_observations counter\n",
+		`http_latency_observations_total 1 # {trace_id="abc123"} 0.5 `,
+		"# TYPE default_size_observations counter\n",
+		"http_latency_seconds_count 1\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+	assert.True(t, strings.HasSuffix(out, "# EOF\n"))
+}
+
+func Test_acceptsOpenMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{name: "empty", accept: "", want: false},
+		{name: "prometheus", accept: "text/plain;version=0.0.4;q=1,*/*;q=0.1", want: false},
+		{name: "openmetrics", accept: "application/openmetrics-text;version=1.0.0;q=0.8,text/plain;q=0.5", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, acceptsOpenMetrics(tt.accept))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// DefaultReplayBatchSize is the number of data points written per batch if none is configured.
+const DefaultReplayBatchSize = 5000
+
+// contextRetentionPolicy sets the retention policy of the following lines as in the export format of InfluxDB.
+const contextRetentionPolicy = "# CONTEXT-RETENTION-POLICY:"
+
+// Replayer writes data points recorded by a file sink to another sink, e.g. one created by NewInfluxSink.
+// Files in JSONLines and LineProtocol format are supported, lines starting with `#` are skipped.
+// A `# CONTEXT-RETENTION-POLICY: <rp>` line sets the retention policy of the measurements that follow.
+// Note that JSON decodes all numeric field values as float64.
+type Replayer struct {
+	// Sink receives the data points.
+	Sink Sink
+	// BatchSize limits the number of data points per write. Defaults to DefaultReplayBatchSize.
+	BatchSize int
+	// Precision of the timestamps in line protocol files (s, ms, us, ns). Defaults to ns.
+	Precision string
+	// OnParseError is called with the line number and error of lines that cannot be parsed.
+	// If it is set those lines are skipped, otherwise the replay stops with an error.
+	OnParseError func(line int, err error)
+}
+
+// ReplayFile replays the given file. Files ending in `.gz` are decompressed.
+func (r Replayer) ReplayFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	return r.Replay(ctx, rd)
+}
+
+// Replay reads the data points from rd and writes them to the sink in batches.
+func (r Replayer) Replay(ctx context.Context, rd io.Reader) error {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultReplayBatchSize
+	}
+	if o, ok := r.Sink.(Opener); ok {
+		if err := o.Open(); err != nil {
+			return err
+		}
+	}
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		points []client.Point
+		rps    map[string]string
+		rp     string
+		line   int
+	)
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if bytes.HasPrefix(b, []byte(contextRetentionPolicy)) {
+			rp = string(bytes.TrimSpace(b[len(contextRetentionPolicy):]))
+			continue
+		}
+		if len(b) == 0 || b[0] == '#' {
+			continue
+		}
+
+		p, err := r.parse(b)
+		if err != nil && r.OnParseError != nil {
+			r.OnParseError(line, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to parse line %d: %w", line, err)
+		}
+		points = append(points, p)
+		if rp != "" {
+			if rps == nil {
+				rps = make(map[string]string)
+			}
+			rps[p.Measurement] = rp
+		}
+
+		if len(points) >= batchSize {
+			if err := r.write(ctx, points, rps); err != nil {
+				return err
+			}
+			points = points[:0]
+			rps = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(points) == 0 {
+		return nil
+	}
+	return r.write(ctx, points, rps)
+}
+
+func (r Replayer) parse(b []byte) (client.Point, error) {
+	var p client.Point
+	if b[0] == '{' {
+		err := p.UnmarshalJSON(b)
+		return p, err
+	}
+
+	pts, err := models.ParsePointsWithPrecision(b, time.Now(), lineProtocolPrecision(r.Precision))
+	if err != nil {
+		return p, err
+	}
+	fields, err := pts[0].Fields()
+	if err != nil {
+		return p, err
+	}
+
+	return client.Point{
+		Measurement: string(pts[0].Name()),
+		Tags:        pts[0].Tags().Map(),
+		Fields:      fields,
+		Time:        pts[0].Time(),
+	}, nil
+}
+
+func (r Replayer) write(ctx context.Context, points []client.Point, rps map[string]string) error {
+	batch := Batch{
+		Points:            make([]client.Point, len(points)),
+		Time:              time.Now(),
+		RetentionPolicies: rps,
+	}
+	copy(batch.Points, points)
+	return r.Sink.Write(ctx, batch)
+}
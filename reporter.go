@@ -2,8 +2,16 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client"
@@ -12,9 +20,25 @@ import (
 
 var defaultReporter Reporter
 
+var errAlreadyRunning = errors.New("metrics.Reporter already running")
+
 // SetDefaultReporter sets the default reporter to be used for all metrics. It can be overwritten per Measurement.
+// Metrics created before a default reporter was set, e.g. in package level variables, are registered
+// to the reporter now and get its tags and StatsD client. Until then they are registered to the
+// default registry of go-metrics. It is safe for concurrent use.
 func SetDefaultReporter(reporter Reporter) {
+	bindMutex.Lock()
+	defer bindMutex.Unlock()
+
+	defaultMutex.Lock()
 	defaultReporter = reporter
+	var pending []metric
+	if reporter != nil {
+		pending, pendingMetrics = pendingMetrics, nil
+	}
+	defaultMutex.Unlock()
+
+	bindPending(reporter, pending)
 }
 
 // Reporter defines a metrics reporter. It is responsible for connection handling
@@ -28,9 +52,49 @@ type Reporter interface {
 	Stop()
 }
 
+// The reporters created by this package implement the following interfaces as well.
+// They are separate from Reporter to keep existing implementations of it working.
+
+// ContextRunner is implemented by reporters that can run until a context is done.
+type ContextRunner interface {
+	RunContext(ctx context.Context) error
+}
+
+// Shutdowner is implemented by reporters that can deliver the remaining data points before they stop.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Unregisterer is implemented by reporters that metrics can be removed from.
+type Unregisterer interface {
+	Unregister(name string)
+}
+
+// PrometheusExporter is implemented by reporters that expose their metrics to Prometheus.
+type PrometheusExporter interface {
+	PrometheusHandler() http.Handler
+}
+
+// StatusReporter is implemented by reporters that report their status.
+type StatusReporter interface {
+	Status() Status
+	StatusHandler() http.Handler
+	DroppedPoints() int64
+}
+
+var _ interface {
+	Reporter
+	ContextRunner
+	Shutdowner
+	Unregisterer
+	PrometheusExporter
+	StatusReporter
+} = (*reporter)(nil)
+
 type typeChecker func(m metric) bool
 
 // NewReporter creates a new reporter which holds the influxDB connection and sends data to it.
+// An URL with the scheme `udp` (e.g. `udp://localhost:8089`) writes to the UDP listener of InfluxDB.
 func NewReporter(influxURL, database string, options ...ReporterOption) Reporter {
 	dbURL, err := url.Parse(influxURL)
 	if err != nil {
@@ -38,12 +102,39 @@ func NewReporter(influxURL, database string, options ...ReporterOption) Reporter
 		return nil
 	}
 
+	return newReporter(InfluxConfig{
+		URL: *dbURL,
+		DB:  database,
+	}, options...)
+}
+
+// NewReporterV2 creates a new reporter which sends data to the write API of InfluxDB 2.x.
+// The token is used for authentication and the data is written to the bucket of the given organization.
+func NewReporterV2(influxURL, org, bucket, token string, options ...ReporterOption) Reporter {
+	dbURL, err := url.Parse(influxURL)
+	if err != nil {
+		log.Printf("metrics.NewReporterV2: unable to parse InfluxDB url %s: %v", influxURL, err)
+		return nil
+	}
+
+	return newReporter(InfluxConfig{
+		URL:    *dbURL,
+		V2:     true,
+		Org:    org,
+		Bucket: bucket,
+		Token:  token,
+	}, options...)
+}
+
+// NewSinkReporter creates a new reporter which sends the data to the given sink instead of InfluxDB.
+func NewSinkReporter(sink Sink, options ...ReporterOption) Reporter {
+	return newReporter(InfluxConfig{}, append([]ReporterOption{WithSink(sink)}, options...)...)
+}
+
+func newReporter(srv InfluxConfig, options ...ReporterOption) *reporter {
 	ctx, cancel := context.WithCancel(context.Background())
 	r := &reporter{
-		server: server{
-			URL: *dbURL,
-			DB:  database,
-		},
+		server:   srv,
 		registry: metrics.DefaultRegistry,
 		interval: 10 * time.Second,
 		ctx:      ctx,
@@ -53,30 +144,71 @@ func NewReporter(influxURL, database string, options ...ReporterOption) Reporter
 	for _, option := range options {
 		option(r)
 	}
-	return r
-}
 
-type server struct {
-	URL  url.URL
-	DB   string
-	User string
-	Pass string
+	if len(r.sinks) == 0 {
+		r.sinks = append(r.sinks, newSinkWorker(&influxSink{
+			server: r.server,
+			client: r.client,
+		}))
+	}
+	for i, w := range r.sinks {
+		w.chunking = r.chunking
+		if r.retry != nil && w.retry == nil {
+			w.retry = newRetryBuffer(*r.retry)
+		}
+		if r.spool != nil && w.spoolConf == nil {
+			conf := *r.spool
+			conf.Dir = filepath.Join(conf.Dir, "sink-"+strconv.Itoa(i))
+			w.spoolConf = &conf
+		}
+	}
+	if r.selfName != "" {
+		r.self = newSelfMetrics(r, r.selfName)
+	}
+	return r
 }
 
-// reporter implements a influxDB reporter. This is responsible for the influxDB connection
+// reporter implements a metrics reporter. This is responsible for the connection to the sink
 // and sending data to it. It also holds the metrics registry all the metrics get registered to.
 type reporter struct {
+	// series counts the series of all vectors, rejectedSeries the series exceeding a
+	// cardinality limit. Accessed atomically.
+	series         int64
+	rejectedSeries int64
+
 	registry metrics.Registry
+	sinks    []*sinkWorker
 	client   dbClient
-	server   server
+	server   InfluxConfig
 
 	interval time.Duration
 	tags     map[string]string
 	align    bool
-
-	running bool
-	ctx     context.Context
-	cancel  context.CancelFunc
+	statsd   *StatsDClient
+	logger   Logger
+	hooks    hooks
+	selfName string
+	self     *selfMetrics
+	retry    *RetryConfig
+	spool    *SpoolConfig
+	chunking chunking
+
+	maxSeries int
+	overflow  CardinalityOverflow
+	ttl       int
+	// expireMutex serializes the expiry of metrics with their revival.
+	expireMutex sync.Mutex
+
+	// rps maps measurements to retention policies. Replaced on every change, guarded by rpMutex.
+	rps     map[string]string
+	rpMutex sync.Mutex
+
+	m        sync.Mutex
+	running  bool
+	stopLoop chan struct{}
+	loopDone chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
 // Register registers a metric to the reporter. Data points from a registered
@@ -99,48 +231,80 @@ func (r *reporter) Tags() map[string]string {
 	return r.tags
 }
 
+// PrometheusHandler returns a http.Handler exposing all registered metrics in the Prometheus
+// text exposition format. The data is collected on every request: the reporter does not need
+// to be running and can be used without any connection to InfluxDB.
+func (r *reporter) PrometheusHandler() http.Handler {
+	return promHandler{registry: r.registry}
+}
+
 // Run starts sending measurements regularly with given interval.
 // This is a blocking call and is usually called with `go reporter.Run()`.
+// Errors are logged, use RunContext to handle them.
 func (r *reporter) Run() {
+	if err := r.RunContext(context.Background()); err != nil {
+		r.logError("metrics reporter error", err)
+	}
+}
+
+// RunContext starts sending measurements regularly with given interval until the context
+// is done or the reporter is stopped. It returns an error if the reporter is already running
+// or a sink cannot be opened. Once the context is done the reporter is stopped like with
+// Stop and the error of the context is returned.
+func (r *reporter) RunContext(ctx context.Context) error {
+	r.m.Lock()
 	if r.running {
-		log.Println("metrics.Reporter already running")
-		return
+		r.m.Unlock()
+		return errAlreadyRunning
 	}
 
 	if err := r.open(); err != nil {
-		log.Printf("unable to reconnect InfluxDB client: %v", err)
-		return
+		r.m.Unlock()
+		return fmt.Errorf("unable to open metrics sink: %w", err)
 	}
 
-	r.run()
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.running = true
+	r.stopLoop, r.loopDone = stop, done
+	r.attachSinks()
+	for _, w := range r.sinks {
+		w.start(r.ctx, r.interval)
+	}
+	r.m.Unlock()
+
+	return r.run(ctx, stop, done)
 }
-func (r *reporter) run() {
+
+func (r *reporter) run(ctx context.Context, stop <-chan struct{}, done chan<- struct{}) error {
+	defer close(done)
+
 	var (
 		pts            []client.Point
 		intervalTicker = time.NewTicker(r.interval)
-		pingTicker     = time.NewTicker(time.Second * 5)
 	)
+	defer intervalTicker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			r.cancel()
+			return ctx.Err()
 		case <-r.ctx.Done():
-			return
+			return nil
+		case <-stop:
+			return nil
 		case <-intervalTicker.C:
+			start := time.Now()
 			pts = pts[:0]
 			pts = r.getPoints(pts)
-
-			if err := r.write(pts); err != nil {
-				log.Printf("unable to send metrics to InfluxDB: %v", err)
+			if r.self != nil {
+				r.self.collect.UpdateSince(start)
 			}
-		case <-pingTicker.C:
-			_, _, err := r.client.Ping()
-			if err != nil {
-				log.Printf("got error while sending a ping to InfluxDB: %v", err)
-
-				if err = r.open(); err != nil {
-					log.Printf("unable to reconnect InfluxDB client: %v", err)
-				}
+			if r.ttl > 0 {
+				r.expire(start)
 			}
+
+			r.write(pts)
 		}
 	}
 }
@@ -159,20 +323,23 @@ func (r *reporter) getPoints(pts []client.Point) []client.Point {
 }
 
 func (r *reporter) basicMetric(pts []client.Point, name string, data interface{}) []client.Point {
+	// the wrappers only exist for the collection: they are neither registered nor bound to a reporter
+	options := []Option{WithMetric(data), WithReporter(nil), standalone()}
+
 	var m Metric
-	switch metric := data.(type) {
+	switch data.(type) {
 	case metrics.Counter:
-		m = newCounter(name, WithMetric(metric))
+		m = newCounter(name, options...)
 	case metrics.Gauge:
-		m = newGauge(name, WithMetric(metric))
+		m = newGauge(name, options...)
 	case metrics.GaugeFloat64:
-		m = newGaugeFloat64(name, WithMetric(metric))
+		m = newGaugeFloat64(name, options...)
 	case metrics.Histogram:
-		m = newHistogram(name, WithMetric(metric))
+		m = newHistogram(name, options...)
 	case metrics.Meter:
-		m = newMeter(name, WithMetric(metric))
+		m = newMeter(name, options...)
 	case metrics.Timer:
-		m = newTimer(name, WithMetric(metric))
+		m = newTimer(name, options...)
 	default:
 		return pts
 	}
@@ -180,29 +347,116 @@ func (r *reporter) basicMetric(pts []client.Point, name string, data interface{}
 	return m.AddPoints(pts)
 }
 
-func (r *reporter) open() (err error) {
-	if r.client != nil {
-		return nil
+func (r *reporter) open() error {
+	for _, w := range r.sinks {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write hands the points to all sinks. The points are copied since the sinks
+// write them concurrently while the metrics keep reusing their field maps.
+func (r *reporter) write(points []client.Point) {
+	batch := Batch{
+		Points: clonePoints(points),
+		Time:   r.getNow(),
+		Tags:   r.tags,
+
+		RetentionPolicies: r.getRetentionPolicies(),
+	}
+	for _, w := range r.sinks {
+		w.enqueue(batch)
+	}
+}
+
+// setRetentionPolicy writes the measurement to the given retention policy.
+func (r *reporter) setRetentionPolicy(measurement, rp string) {
+	r.rpMutex.Lock()
+	defer r.rpMutex.Unlock()
+
+	rps := make(map[string]string, len(r.rps)+1)
+	for k, v := range r.rps {
+		rps[k] = v
 	}
+	rps[measurement] = rp
+	r.rps = rps
+}
+
+func (r *reporter) getRetentionPolicies() map[string]string {
+	r.rpMutex.Lock()
+	defer r.rpMutex.Unlock()
+	return r.rps
+}
+
+// attachSinks hands the logger and the hooks of the reporter to the sinks.
+func (r *reporter) attachSinks() {
+	for i, w := range r.sinks {
+		w.index = i
+		w.hooks = &r.hooks
+		if r.self != nil {
+			w.stats = r.self.sinks[i]
+		}
+		if w.logger == nil {
+			w.logger = r.logger
+		}
+	}
+}
+
+func (r *reporter) logError(msg string, err error) {
+	if r.logger == nil {
+		log.Println(err)
+		return
+	}
+	r.logger.Error(msg, "error", err)
+}
 
-	r.client, err = client.NewClient(client.Config{
-		URL:      r.server.URL,
-		Username: r.server.User,
-		Password: r.server.Pass,
+// Status returns the current status of the reporter and its sinks.
+func (r *reporter) Status() Status {
+	r.m.Lock()
+	done := r.loopDone
+	r.m.Unlock()
+
+	status := Status{
+		Running:        done != nil && !isClosed(done) && r.ctx.Err() == nil,
+		RejectedSeries: atomic.LoadInt64(&r.rejectedSeries),
+		Sinks:          make([]SinkStatus, 0, len(r.sinks)),
+	}
+	r.registry.Each(func(string, interface{}) {
+		status.Metrics++
 	})
+	for _, w := range r.sinks {
+		status.Sinks = append(status.Sinks, w.status())
+	}
+	return status
+}
 
-	return err
+// StatusHandler returns a http.Handler serving the status of the reporter as JSON, e.g. for
+// readiness probes. It responds with 503 Service Unavailable if the reporter is not running
+// or none of its sinks is connected. Do not use it as liveness probe: an unavailable sink is
+// not fixed by restarting the process.
+func (r *reporter) StatusHandler() http.Handler {
+	return statusHandler{reporter: r}
 }
 
-func (r *reporter) write(points []client.Point) error {
-	bps := client.BatchPoints{
-		Points:   points,
-		Database: r.server.DB,
-		Time:     r.getNow(),
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
 	}
+}
 
-	_, err := r.client.Write(bps)
-	return err
+// DroppedPoints returns the number of data points that could not be written to the sinks:
+// either because a sink was busy, the write failed without retry or the retry buffer was full.
+func (r *reporter) DroppedPoints() int64 {
+	var dropped int64
+	for _, w := range r.sinks {
+		dropped += w.droppedPoints()
+	}
+	return dropped
 }
 
 func (r *reporter) getNow() time.Time {
@@ -214,6 +468,72 @@ func (r *reporter) getNow() time.Time {
 }
 
 // Stop stops the reporter. It should be discarded after and cannot be restartet.
+// Data not written yet is lost, use Shutdown to deliver it first.
 func (r *reporter) Stop() {
 	r.cancel()
 }
+
+// Shutdown stops the reporter gracefully: it collects the data points one last time, writes them
+// together with the pending and buffered batches to the sinks and waits until the writes finished
+// or the context is done. Batches that cannot be written are spooled if configured.
+// The returned error summarizes what could not be delivered.
+func (r *reporter) Shutdown(ctx context.Context) error {
+	defer r.cancel()
+
+	r.m.Lock()
+	stop, done := r.stopLoop, r.loopDone
+	r.stopLoop = nil
+	r.m.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	} else {
+		r.m.Lock()
+		r.attachSinks()
+		r.m.Unlock()
+	}
+
+	batch := Batch{
+		Points: r.getPoints(nil),
+		Time:   r.getNow(),
+		Tags:   r.tags,
+
+		RetentionPolicies: r.getRetentionPolicies(),
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(r.sinks))
+	)
+	for i, w := range r.sinks {
+		wg.Add(1)
+		go func(i int, w *sinkWorker) {
+			defer wg.Done()
+			errs[i] = w.shutdown(ctx, batch)
+		}(i, w)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return fmt.Errorf("metrics shutdown aborted: %w", ctx.Err())
+	}
+
+	var msgs []string
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("sink %d: %v", i, err))
+		}
+	}
+	if len(msgs) != 0 {
+		return fmt.Errorf("unable to deliver all metrics: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"testing"
 	"time"
@@ -34,6 +37,7 @@ func TestNewReporter(t *testing.T) {
 			want: &reporter{
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
+				sinks:    []*sinkWorker{{sink: &influxSink{}}},
 			},
 		},
 		{
@@ -45,7 +49,7 @@ func TestNewReporter(t *testing.T) {
 			want: &reporter{
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
-				server: server{
+				server: InfluxConfig{
 					URL: url.URL{
 						Scheme: "https",
 						Host:   "someDomain.com",
@@ -53,6 +57,18 @@ func TestNewReporter(t *testing.T) {
 					},
 					DB: "someDB",
 				},
+				sinks: []*sinkWorker{{
+					sink: &influxSink{
+						server: InfluxConfig{
+							URL: url.URL{
+								Scheme: "https",
+								Host:   "someDomain.com",
+								Path:   "/somePath",
+							},
+							DB: "someDB",
+						},
+					},
+				}},
 			},
 		},
 		{
@@ -66,6 +82,7 @@ func TestNewReporter(t *testing.T) {
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
 				tags:     map[string]string{"foo": "bar"},
+				sinks:    []*sinkWorker{{sink: &influxSink{}}},
 			},
 		},
 		{
@@ -78,6 +95,7 @@ func TestNewReporter(t *testing.T) {
 			want: &reporter{
 				registry: metrics.NewRegistry(),
 				interval: 10 * time.Second,
+				sinks:    []*sinkWorker{{sink: &influxSink{}}},
 			},
 		},
 		{
@@ -90,6 +108,7 @@ func TestNewReporter(t *testing.T) {
 			want: &reporter{
 				registry: metrics.DefaultRegistry,
 				interval: 5 * time.Second,
+				sinks:    []*sinkWorker{{sink: &influxSink{}}},
 			},
 		},
 		{
@@ -103,6 +122,7 @@ func TestNewReporter(t *testing.T) {
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
 				align:    true,
+				sinks:    []*sinkWorker{{sink: &influxSink{}}},
 			},
 		},
 		{
@@ -115,10 +135,56 @@ func TestNewReporter(t *testing.T) {
 			want: &reporter{
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
-				server: server{
+				server: InfluxConfig{
 					User: "user",
 					Pass: "pass",
 				},
+				sinks: []*sinkWorker{{
+					sink: &influxSink{
+						server: InfluxConfig{
+							User: "user",
+							Pass: "pass",
+						},
+					},
+				}},
+			},
+		},
+		{
+			name: "gzip and precision",
+			args: args{
+				options: []ReporterOption{
+					Gzip(),
+					Precision("ms"),
+				},
+			},
+			want: &reporter{
+				registry: metrics.DefaultRegistry,
+				interval: 10 * time.Second,
+				server: InfluxConfig{
+					Gzip:      true,
+					Precision: "ms",
+				},
+				sinks: []*sinkWorker{{
+					sink: &influxSink{
+						server: InfluxConfig{
+							Gzip:      true,
+							Precision: "ms",
+						},
+					},
+				}},
+			},
+		},
+		{
+			name: "sink",
+			args: args{
+				options: []ReporterOption{
+					WithSink(&testSink{}),
+				},
+			},
+			want: &reporter{
+				registry: metrics.DefaultRegistry,
+				interval: 10 * time.Second,
+				sinks:    []*sinkWorker{{sink: &testSink{}}},
 			},
 		},
 		{
@@ -132,6 +198,11 @@ func TestNewReporter(t *testing.T) {
 				registry: metrics.DefaultRegistry,
 				interval: 10 * time.Second,
 				client:   &testClient{},
+				sinks: []*sinkWorker{{
+					sink: &influxSink{
+						client: &testClient{},
+					},
+				}},
 			},
 		},
 	}
@@ -211,6 +282,166 @@ func Test_reporter_Get(t *testing.T) {
 	}
 }
 
+func TestReporter_Shutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     bool
+		write   func(ctx context.Context, batch Batch) error
+		wantErr string
+	}{
+		{
+			name: "running",
+			run:  true,
+		},
+		{
+			name: "not running",
+		},
+		{
+			name: "not running with sink honoring the context",
+			write: func(ctx context.Context, _ Batch) error {
+				return ctx.Err()
+			},
+		},
+		{
+			name: "write fails",
+			run:  true,
+			write: func(_ context.Context, _ Batch) error {
+				return errors.New("unavailable")
+			},
+			wantErr: "unable to deliver all metrics: sink 0: 1 points not delivered: unavailable",
+		},
+		{
+			name: "deadline",
+			run:  true,
+			write: func(_ context.Context, _ Batch) error {
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			},
+			wantErr: "metrics shutdown aborted: context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			written := make(chan Batch, 1)
+			sink := &testSink{writeCall: func(ctx context.Context, batch Batch) error {
+				if tt.write != nil {
+					if err := tt.write(ctx, batch); err != nil {
+						return err
+					}
+				}
+				written <- batch
+				return nil
+			}}
+
+			reporter := NewSinkReporter(sink, Interval(time.Hour), Registry(metrics.NewRegistry()))
+			NewCounter("testCounter", WithReporter(reporter)).Inc(5)
+
+			if tt.run {
+				go reporter.Run()
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			err := reporter.(Shutdowner).Shutdown(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			select {
+			case batch := <-written:
+				if assert.Len(t, batch.Points, 1) {
+					assert.Equal(t, int64(5), batch.Points[0].Fields["testCounter.count"])
+				}
+			default:
+				t.Error("no batch written")
+			}
+		})
+	}
+}
+
+type testOpener struct {
+	testSink
+	openErr error
+}
+
+func (s *testOpener) Open() error {
+	return s.openErr
+}
+
+type testLogger struct {
+	msgs chan string
+}
+
+func (l *testLogger) Error(msg string, args ...interface{}) {
+	l.msgs <- fmt.Sprintln(append([]interface{}{msg}, args...)...)
+}
+
+func TestReporter_RunContext(t *testing.T) {
+	t.Run("context done", func(t *testing.T) {
+		reporter := NewSinkReporter(&testSink{}, Registry(metrics.NewRegistry()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+		go func() {
+			errs <- reporter.(ContextRunner).RunContext(ctx)
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, errAlreadyRunning, reporter.(ContextRunner).RunContext(context.Background()))
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-errs)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		reporter := NewSinkReporter(&testSink{}, Registry(metrics.NewRegistry()))
+
+		errs := make(chan error)
+		go func() {
+			errs <- reporter.(ContextRunner).RunContext(context.Background())
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		reporter.Stop()
+		assert.NoError(t, <-errs)
+	})
+
+	t.Run("open fails", func(t *testing.T) {
+		reporter := NewSinkReporter(&testOpener{openErr: errors.New("refused")}, Registry(metrics.NewRegistry()))
+
+		err := reporter.(ContextRunner).RunContext(context.Background())
+		assert.EqualError(t, err, "unable to open metrics sink: refused")
+	})
+}
+
+func TestWithLogger(t *testing.T) {
+	logger := &testLogger{msgs: make(chan string, 10)}
+	sink := &testSink{writeCall: func(_ context.Context, _ Batch) error {
+		return errors.New("unavailable")
+	}}
+
+	reporter := NewSinkReporter(sink,
+		Interval(10*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+		WithLogger(logger),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	NewGauge("testGauge", WithReporter(reporter)).Update(5)
+
+	select {
+	case msg := <-logger.msgs:
+		assert.Equal(t, "metrics sink error error unable to send metrics: unavailable\n", msg)
+	case <-time.After(time.Second):
+		t.Fatal("no error logged")
+	}
+}
+
 func Benchmark_reporter_getPoints(b *testing.B) {
 	r := NewReporter("", "", Registry(metrics.NewRegistry())).(*reporter)
 
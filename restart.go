@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// restarter is implemented by metrics holding a meter: a stopped meter of go-metrics does not
+// count anymore. Expired metrics are stopped and restarted once they are updated again.
+type restarter interface {
+	restart()
+}
+
+func restartMetric(m interface{}) {
+	if r, ok := m.(restarter); ok {
+		r.restart()
+	}
+}
+
+// restartMeter is a meter that is replaced by a new one when restarted.
+type restartMeter struct {
+	current atomic.Value // meterRef
+}
+
+type meterRef struct {
+	metrics.Meter
+}
+
+func newRestartMeter(m metrics.Meter) *restartMeter {
+	r := &restartMeter{}
+	r.current.Store(meterRef{m})
+	return r
+}
+
+func (r *restartMeter) meter() metrics.Meter {
+	return r.current.Load().(meterRef).Meter
+}
+
+func (r *restartMeter) restart() {
+	r.current.Store(meterRef{metrics.NewMeter()})
+}
+
+// Count returns the number of events recorded.
+func (r *restartMeter) Count() int64 { return r.meter().Count() }
+
+// Mark records the occurrence of n events.
+func (r *restartMeter) Mark(n int64) { r.meter().Mark(n) }
+
+// Rate1 returns the one-minute moving average rate of events per second.
+func (r *restartMeter) Rate1() float64 { return r.meter().Rate1() }
+
+// Rate5 returns the five-minute moving average rate of events per second.
+func (r *restartMeter) Rate5() float64 { return r.meter().Rate5() }
+
+// Rate15 returns the fifteen-minute moving average rate of events per second.
+func (r *restartMeter) Rate15() float64 { return r.meter().Rate15() }
+
+// RateMean returns the meter's mean rate of events per second.
+func (r *restartMeter) RateMean() float64 { return r.meter().RateMean() }
+
+// Snapshot returns a read-only copy of the meter.
+func (r *restartMeter) Snapshot() metrics.Meter { return r.meter().Snapshot() }
+
+// Stop stops the meter.
+func (r *restartMeter) Stop() { r.meter().Stop() }
+
+// restartTimer is a timer that gets a new meter when restarted. The recorded durations are kept
+// if the histogram of the timer is known, i.e. the timer was not provided with WithMetric.
+type restartTimer struct {
+	current   atomic.Value // timerRef
+	histogram metrics.Histogram
+}
+
+type timerRef struct {
+	metrics.Timer
+}
+
+// newRestartTimer creates a timer from the histogram or wraps the given timer if there is none.
+func newRestartTimer(t metrics.Timer, h metrics.Histogram) *restartTimer {
+	r := &restartTimer{histogram: h}
+	if h != nil {
+		t = metrics.NewCustomTimer(h, metrics.NewMeter())
+	}
+	r.current.Store(timerRef{t})
+	return r
+}
+
+func (r *restartTimer) timer() metrics.Timer {
+	return r.current.Load().(timerRef).Timer
+}
+
+func (r *restartTimer) restart() {
+	if r.histogram == nil {
+		r.current.Store(timerRef{metrics.NewTimer()})
+		return
+	}
+	r.current.Store(timerRef{metrics.NewCustomTimer(r.histogram, metrics.NewMeter())})
+}
+
+// Count returns the number of events recorded.
+func (r *restartTimer) Count() int64 { return r.timer().Count() }
+
+// Max returns the maximum value in the sample.
+func (r *restartTimer) Max() int64 { return r.timer().Max() }
+
+// Mean returns the mean of the values in the sample.
+func (r *restartTimer) Mean() float64 { return r.timer().Mean() }
+
+// Min returns the minimum value in the sample.
+func (r *restartTimer) Min() int64 { return r.timer().Min() }
+
+// Percentile returns an arbitrary percentile of the values in the sample.
+func (r *restartTimer) Percentile(p float64) float64 { return r.timer().Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the sample.
+func (r *restartTimer) Percentiles(ps []float64) []float64 { return r.timer().Percentiles(ps) }
+
+// Rate1 returns the one-minute moving average rate of events per second.
+func (r *restartTimer) Rate1() float64 { return r.timer().Rate1() }
+
+// Rate5 returns the five-minute moving average rate of events per second.
+func (r *restartTimer) Rate5() float64 { return r.timer().Rate5() }
+
+// Rate15 returns the fifteen-minute moving average rate of events per second.
+func (r *restartTimer) Rate15() float64 { return r.timer().Rate15() }
+
+// RateMean returns the meter's mean rate of events per second.
+func (r *restartTimer) RateMean() float64 { return r.timer().RateMean() }
+
+// Snapshot returns a read-only copy of the timer.
+func (r *restartTimer) Snapshot() metrics.Timer { return r.timer().Snapshot() }
+
+// StdDev returns the standard deviation of the values in the sample.
+func (r *restartTimer) StdDev() float64 { return r.timer().StdDev() }
+
+// Stop stops the meter of the timer.
+func (r *restartTimer) Stop() { r.timer().Stop() }
+
+// Sum returns the sum in the sample.
+func (r *restartTimer) Sum() int64 { return r.timer().Sum() }
+
+// Time records the duration of the execution of the given function.
+func (r *restartTimer) Time(f func()) { r.timer().Time(f) }
+
+// Update records the duration of an event.
+func (r *restartTimer) Update(d time.Duration) { r.timer().Update(d) }
+
+// UpdateSince records the duration of an event that started at the given time and ends now.
+func (r *restartTimer) UpdateSince(t time.Time) { r.timer().UpdateSince(t) }
+
+// Variance returns the variance of the values in the sample.
+func (r *restartTimer) Variance() float64 { return r.timer().Variance() }
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"math/rand"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// RetryConfig configures the buffering of batches a sink failed to write. The buffered
+// batches are retried with exponential backoff. If a limit is reached the oldest batches
+// are dropped first. A limit of 0 means no limit.
+type RetryConfig struct {
+	// MaxPoints limits the number of buffered data points.
+	MaxPoints int
+	// MaxBytes limits the size of the buffered data points in line protocol.
+	MaxBytes int
+	// MaxAge drops batches collected longer ago than the given duration.
+	MaxAge time.Duration
+	// MinBackoff is the wait time before the first retry. Defaults to 1 second.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait time between retries. Defaults to 1 minute.
+	MaxBackoff time.Duration
+}
+
+type retryBatch struct {
+	batch Batch
+	bytes int
+}
+
+// retryBuffer holds the batches of a sink that failed to be written.
+type retryBuffer struct {
+	conf RetryConfig
+	rand *rand.Rand
+
+	batches  []retryBatch
+	points   int
+	bytes    int
+	attempts int
+}
+
+func newRetryBuffer(conf RetryConfig) *retryBuffer {
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = time.Second
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = time.Minute
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = conf.MinBackoff
+	}
+	return &retryBuffer{
+		conf: conf,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *retryBuffer) empty() bool {
+	return len(b.batches) == 0
+}
+
+// push adds the batch to the buffer and returns the batches dropped to stay within the limits.
+// The time of the batch is set on every point so the points keep their original timestamp.
+func (b *retryBuffer) push(batch Batch) []Batch {
+	points := make([]client.Point, len(batch.Points))
+	var size int
+	for i, p := range batch.Points {
+		if p.Time.IsZero() {
+			p.Time = batch.Time
+		}
+		points[i] = p
+		size += len(appendLine(nil, p, batch.Time, ""))
+	}
+	batch.Points = points
+
+	b.batches = append(b.batches, retryBatch{batch: batch, bytes: size})
+	b.points += len(points)
+	b.bytes += size
+
+	return b.enforceLimits(time.Now())
+}
+
+// peek returns the oldest batch.
+func (b *retryBuffer) peek() Batch {
+	return b.batches[0].batch
+}
+
+// pop removes the oldest batch.
+func (b *retryBuffer) pop() {
+	b.drop()
+	if b.empty() {
+		b.attempts = 0
+	}
+}
+
+// takeAll removes and returns all buffered batches.
+func (b *retryBuffer) takeAll() []Batch {
+	batches := make([]Batch, 0, len(b.batches))
+	for !b.empty() {
+		batches = append(batches, b.drop())
+	}
+	b.attempts = 0
+	return batches
+}
+
+func (b *retryBuffer) drop() Batch {
+	rb := b.batches[0]
+	b.batches[0] = retryBatch{}
+	b.batches = b.batches[1:]
+	b.points -= len(rb.batch.Points)
+	b.bytes -= rb.bytes
+	return rb.batch
+}
+
+// enforceLimits drops the oldest batches until the buffer is within its limits.
+// It returns the dropped batches.
+func (b *retryBuffer) enforceLimits(now time.Time) []Batch {
+	var dropped []Batch
+	for !b.empty() {
+		switch {
+		case b.conf.MaxPoints > 0 && b.points > b.conf.MaxPoints,
+			b.conf.MaxBytes > 0 && b.bytes > b.conf.MaxBytes,
+			b.conf.MaxAge > 0 && now.Sub(b.batches[0].batch.Time) > b.conf.MaxAge:
+			dropped = append(dropped, b.drop())
+		default:
+			return dropped
+		}
+	}
+	return dropped
+}
+
+// backoff returns the wait time until the next retry: exponentially growing with every
+// attempt, capped to MaxBackoff and with a jitter of up to half the wait time.
+func (b *retryBuffer) backoff() time.Duration {
+	d := b.conf.MaxBackoff
+	if b.attempts < 32 {
+		if exp := b.conf.MinBackoff << uint(b.attempts); exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	b.attempts++
+
+	half := int64(d / 2)
+	return time.Duration(half + b.rand.Int63n(half+1))
+}
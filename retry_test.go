@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_retryBuffer_push(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		conf        RetryConfig
+		batches     []Batch
+		wantDropped int
+		wantPoints  int
+	}{
+		{
+			name:       "no limits",
+			batches:    []Batch{testBatch(2, now), testBatch(3, now)},
+			wantPoints: 5,
+		},
+		{
+			name:        "max points drops oldest batch",
+			conf:        RetryConfig{MaxPoints: 4},
+			batches:     []Batch{testBatch(2, now), testBatch(3, now)},
+			wantDropped: 2,
+			wantPoints:  3,
+		},
+		{
+			name:        "max bytes",
+			conf:        RetryConfig{MaxBytes: 80},
+			batches:     []Batch{testBatch(2, now), testBatch(2, now)},
+			wantDropped: 2,
+			wantPoints:  2,
+		},
+		{
+			name:        "max age",
+			conf:        RetryConfig{MaxAge: time.Minute},
+			batches:     []Batch{testBatch(2, now.Add(-time.Hour)), testBatch(1, now)},
+			wantDropped: 2,
+			wantPoints:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newRetryBuffer(tt.conf)
+
+			var dropped int
+			for _, batch := range tt.batches {
+				for _, d := range b.push(batch) {
+					dropped += len(d.Points)
+				}
+			}
+
+			assert.Equal(t, tt.wantDropped, dropped)
+			assert.Equal(t, tt.wantPoints, b.points)
+		})
+	}
+}
+
+func Test_retryBuffer_keepsTime(t *testing.T) {
+	ts := time.Unix(1577880000, 0)
+	batch := testBatch(1, ts)
+
+	b := newRetryBuffer(RetryConfig{})
+	b.push(batch)
+
+	assert.Equal(t, ts, b.peek().Points[0].Time)
+	assert.True(t, batch.Points[0].Time.IsZero())
+
+	b.pop()
+	assert.True(t, b.empty())
+	assert.Equal(t, 0, b.bytes)
+}
+
+func Test_retryBuffer_backoff(t *testing.T) {
+	b := newRetryBuffer(RetryConfig{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	for _, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		d := b.backoff()
+		assert.True(t, d >= want/2 && d <= want, "%v not in [%v, %v]", d, want/2, want)
+	}
+
+	b.push(testBatch(1, time.Now()))
+	b.pop()
+	assert.Equal(t, 0, b.attempts)
+}
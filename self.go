@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// DefaultSelfMeasurement is the measurement the metrics of the reporter itself are reported under by default.
+const DefaultSelfMeasurement = "metrics_reporter"
+
+// selfMetrics holds the metrics a reporter reports about itself.
+type selfMetrics struct {
+	collect Timer
+	sinks   []*sinkStats
+}
+
+// sinkStats holds the metrics of a sink. The methods can be called on a nil *sinkStats.
+type sinkStats struct {
+	points     Counter
+	batches    Counter
+	bytes      Counter
+	errors     Counter
+	dropped    Counter
+	latency    Timer
+	ping       Timer
+	retryQueue Gauge
+}
+
+func newSelfMetrics(r *reporter, measurement string) *selfMetrics {
+	s := &selfMetrics{
+		collect: NewTimer("collect", WithMeasurement(measurement), WithReporter(r)),
+	}
+
+	// the registry does not distinguish tags: the index of the sink is part of the name
+	for i := range r.sinks {
+		prefix := "sink" + strconv.Itoa(i) + "."
+		options := []Option{WithMeasurement(measurement), WithReporter(r)}
+		s.sinks = append(s.sinks, &sinkStats{
+			points:     NewCounter(prefix+"points", options...),
+			batches:    NewCounter(prefix+"batches", options...),
+			bytes:      NewCounter(prefix+"bytes", options...),
+			errors:     NewCounter(prefix+"errors", options...),
+			dropped:    NewCounter(prefix+"dropped", options...),
+			latency:    NewTimer(prefix+"write", options...),
+			ping:       NewTimer(prefix+"ping", options...),
+			retryQueue: NewGauge(prefix+"retry_queue", options...),
+		})
+	}
+	return s
+}
+
+func (s *sinkStats) write(batch Batch, d time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.errors.Inc(1)
+		return
+	}
+
+	s.points.Inc(int64(len(batch.Points)))
+	s.batches.Inc(1)
+	s.bytes.Inc(int64(batchSize(batch)))
+	s.latency.Update(d)
+}
+
+func (s *sinkStats) drop(points int) {
+	if s == nil {
+		return
+	}
+	s.dropped.Inc(int64(points))
+}
+
+func (s *sinkStats) pingRTT(rtt time.Duration) {
+	if s == nil {
+		return
+	}
+	s.ping.Update(rtt)
+}
+
+func (s *sinkStats) queue(b *retryBuffer) {
+	if s == nil || b == nil {
+		return
+	}
+	s.retryQueue.Update(int64(b.points))
+}
+
+// batchSize estimates the size of the batch in line protocol with nanosecond precision.
+// It is called on every write: other than the encoders it neither marshals nor escapes the points.
+func batchSize(batch Batch) int {
+	var size int
+	for _, p := range batch.Points {
+		size += pointSize(p, batch.Time)
+	}
+	return size
+}
+
+// pointSize estimates the size of the point in line protocol: `measurement,tags fields timestamp\n`.
+func pointSize(p client.Point, t time.Time) int {
+	if !p.Time.IsZero() {
+		t = p.Time
+	}
+
+	size := len(p.Measurement) + len(p.Fields) + 2 + digits(t.UnixNano())
+	for k, v := range p.Tags {
+		size += len(k) + len(v) + 2
+	}
+
+	var buf [32]byte
+	for k, v := range p.Fields {
+		size += len(k) + 1
+		switch v := v.(type) {
+		case float64:
+			size += len(strconv.AppendFloat(buf[:0], v, 'f', -1, 64))
+		case int64:
+			size += digits(v) + 1
+		case int:
+			size += digits(int64(v)) + 1
+		case uint64:
+			size += len(strconv.AppendUint(buf[:0], v, 10)) + 1
+		case string:
+			size += len(v) + 2
+		case bool:
+			size += len(strconv.AppendBool(buf[:0], v))
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
+
+// digits returns the number of characters of the decimal representation of i.
+func digits(i int64) int {
+	n := 1
+	if i < 0 {
+		n++
+	}
+	for i /= 10; i != 0; i /= 10 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	var written []Batch
+	sink := &testSink{writeCall: func(_ context.Context, batch Batch) error {
+		written = append(written, batch)
+		return nil
+	}}
+
+	rep := NewSinkReporter(sink,
+		Registry(metrics.NewRegistry()),
+		SelfMetrics(""),
+		WithSink(&testSink{writeCall: func(_ context.Context, _ Batch) error {
+			return errors.New("unavailable")
+		}}, OnSinkError(func(error) {})),
+	)
+	NewGauge("testGauge", WithReporter(rep)).Update(5)
+
+	assert.Error(t, rep.(Shutdowner).Shutdown(context.Background()))
+	require.Len(t, written, 1)
+
+	self := rep.(*reporter).self
+	require.Len(t, self.sinks, 2)
+	assert.Equal(t, int64(len(written[0].Points)), self.sinks[0].points.Count())
+	assert.Equal(t, int64(1), self.sinks[0].batches.Count())
+	assert.Equal(t, int64(batchSize(written[0])), self.sinks[0].bytes.Count())
+	assert.Equal(t, int64(1), self.sinks[0].latency.Count())
+	assert.Equal(t, int64(0), self.sinks[0].errors.Count())
+
+	assert.Equal(t, int64(0), self.sinks[1].points.Count())
+	assert.Equal(t, int64(1), self.sinks[1].errors.Count())
+	assert.Equal(t, int64(len(written[0].Points)), self.sinks[1].dropped.Count())
+
+	var measurements = make(map[string]bool)
+	for _, p := range written[0].Points {
+		measurements[p.Measurement] = true
+	}
+	assert.True(t, measurements[DefaultSelfMeasurement])
+}
+
+func Test_sinkStats_ping(t *testing.T) {
+	rep := NewSinkReporter(&testPinger{}, Registry(metrics.NewRegistry()), SelfMetrics("self"))
+	r := rep.(*reporter)
+	r.attachSinks()
+
+	assert.True(t, r.sinks[0].ping())
+	assert.Equal(t, int64(1), r.self.sinks[0].ping.Count())
+	assert.Equal(t, int64(time.Millisecond), r.self.sinks[0].ping.Max())
+}
+
+func Test_batchSize(t *testing.T) {
+	batch := Batch{
+		Points: []client.Point{
+			getPoint("measure", map[string]interface{}{"gauge": int64(-5), "timer": 1.25}, map[string]string{"host": "srv1"}),
+			getPoint("measure", map[string]interface{}{"count": 12, "text": "ok", "up": true}, nil),
+			{Measurement: "timed", Fields: map[string]interface{}{"value": uint64(3)}, Time: time.Unix(1, 0)},
+		},
+		Time: time.Unix(1577880000, 0),
+	}
+
+	var want int
+	for _, p := range batch.Points {
+		want += len(appendLine(nil, p, batch.Time, ""))
+	}
+	assert.Equal(t, want, batchSize(batch))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(10, func() { batchSize(batch) }))
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// Sink defines a destination the reporter sends the collected data points to.
+// InfluxDB is the default sink. Implementing the Sink interface allows sending the
+// metrics to any other destination such as files, stdout or other databases.
+//
+// A Sink can additionally implement the Opener and Pinger interfaces to have its
+// connection handled by the reporter.
+type Sink interface {
+	Write(ctx context.Context, batch Batch) error
+}
+
+// Opener is implemented by sinks that need to open a connection before data can be written.
+// Open is called when the reporter starts and whenever a ping failed.
+type Opener interface {
+	Open() error
+}
+
+// Pinger is implemented by sinks that can check their connection. The reporter
+// pings the sink regularly and re-opens it if the ping fails.
+type Pinger interface {
+	Ping() (time.Duration, error)
+}
+
+// Batch holds the data points collected by the reporter in one interval.
+// A sink must not modify the points.
+type Batch struct {
+	Points []client.Point
+	Time   time.Time
+	// Tags holds the tags of the reporter. They are already part of the tags of every point.
+	Tags map[string]string
+	// RetentionPolicies maps measurements to the retention policy they are written to.
+	// Measurements not contained use the retention policy of the sink. Must not be modified.
+	RetentionPolicies map[string]string
+}
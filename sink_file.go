@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileFormat defines how a file sink encodes the data points.
+type FileFormat string
+
+// Formats supported by the file sink.
+const (
+	// JSONLines writes one JSON object per data point and line.
+	JSONLines FileFormat = "json"
+	// LineProtocol writes the data points in InfluxDB line protocol.
+	LineProtocol FileFormat = "line"
+)
+
+// FileConfig holds the settings of a file sink.
+type FileConfig struct {
+	// Path of the file the data points are appended to.
+	Path string
+	// Format of the file. Defaults to JSONLines.
+	Format FileFormat
+	// MaxSize rotates the file before it would grow beyond the given size in bytes.
+	MaxSize int64
+	// MaxAge rotates the file once it has been written to for the given duration.
+	MaxAge time.Duration
+	// Gzip compresses rotated files.
+	Gzip bool
+	// Precision of the timestamps written in line protocol (s, ms, us, ns). Defaults to ns.
+	Precision string
+	// Database adds the header required by `influx -import` to every line protocol file.
+	Database string
+}
+
+// NewFileSink creates a sink appending the data points of every interval to a file.
+// Rotated files are renamed to `<name>-<timestamp><ext>` and gzipped if configured.
+// Files can be written back to a database with the Replayer or, in line protocol, with `influx -import`.
+func NewFileSink(conf FileConfig) Sink {
+	if conf.Format == "" {
+		conf.Format = JSONLines
+	}
+	return &fileSink{conf: conf}
+}
+
+// NewWriterSink creates a sink writing the data points of every interval to w, e.g. os.Stdout.
+func NewWriterSink(w io.Writer, format FileFormat) Sink {
+	if format == "" {
+		format = JSONLines
+	}
+	return &fileSink{
+		conf: FileConfig{Format: format},
+		w:    w,
+	}
+}
+
+// fileSink implements a Sink writing to a file or writer.
+type fileSink struct {
+	conf FileConfig
+
+	m      sync.Mutex
+	w      io.Writer
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// Open opens the file if it is not open yet.
+func (s *fileSink) Open() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.open()
+}
+
+func (s *fileSink) open() error {
+	if s.w != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.conf.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.file, s.w = f, f
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// Write appends the batch to the file. The file is rotated first if the batch would exceed MaxSize or MaxAge passed.
+func (s *fileSink) Write(_ context.Context, batch Batch) error {
+	data, err := s.encode(batch)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	if s.needsRotation(len(data)) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if s.size == 0 && s.conf.Format == LineProtocol && s.conf.Database != "" {
+		data = append([]byte("# DML\n# CONTEXT-DATABASE: "+s.conf.Database+"\n"), data...)
+	}
+
+	n, err := s.w.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the file. Writers passed to NewWriterSink are not closed.
+func (s *fileSink) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.w = nil, nil
+	return err
+}
+
+func (s *fileSink) encode(batch Batch) ([]byte, error) {
+	var b []byte
+	for _, p := range batch.Points {
+		if s.conf.Format == LineProtocol {
+			b = appendLine(b, p, batch.Time, s.conf.Precision)
+			continue
+		}
+
+		if p.Time.IsZero() {
+			p.Time = batch.Time
+		}
+		line, err := json.Marshal(&p)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	return b, nil
+}
+
+func (s *fileSink) needsRotation(size int) bool {
+	if s.file == nil || s.size == 0 {
+		return false
+	}
+	if s.conf.MaxSize > 0 && s.size+int64(size) > s.conf.MaxSize {
+		return true
+	}
+	return s.conf.MaxAge > 0 && time.Since(s.opened) >= s.conf.MaxAge
+}
+
+// rotate renames the current file, compresses it if configured and opens a new one.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file, s.w = nil, nil
+
+	rotated := rotatedName(s.conf.Path, time.Now())
+	if err := os.Rename(s.conf.Path, rotated); err != nil {
+		return err
+	}
+	if s.conf.Gzip {
+		if err := gzipFile(rotated); err != nil {
+			return err
+		}
+	}
+	return s.open()
+}
+
+// rotatedName inserts the time between the name and extension of the file: metrics.jsonl => metrics-20200101T120000.000.jsonl.
+// A counter is added if a file of that name already exists.
+func rotatedName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(path, ext) + "-" + t.UTC().Format("20060102T150405.000")
+
+	rotated := name + ext
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = name + "-" + strconv.Itoa(i) + ext
+	}
+	return rotated
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile compresses the file to `<path>.gz` and removes the original.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	_ = in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWriterSink(t *testing.T) {
+	tests := []struct {
+		name   string
+		format FileFormat
+		want   string
+	}{
+		{
+			name:   "json lines",
+			format: JSONLines,
+			want: `{"measurement":"measure","time":"2020-01-01T12:00:00Z","fields":{"value":0}}
+{"measurement":"measure","time":"2020-01-01T12:00:00Z","fields":{"value":1}}
+`,
+		},
+		{
+			name:   "line protocol",
+			format: LineProtocol,
+			want: `measure value=0i 1577880000000000000
+measure value=1i 1577880000000000000
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := NewWriterSink(&buf, tt.format)
+
+			assert.NoError(t, s.Write(context.Background(), testBatch(2, time.Unix(1577880000, 0).UTC())))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func Test_fileSink_rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.lp")
+	s := NewFileSink(FileConfig{
+		Path:     path,
+		Format:   LineProtocol,
+		MaxSize:  150,
+		Gzip:     true,
+		Database: "db",
+	})
+	defer s.(*fileSink).Close()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Write(context.Background(), testBatch(2, time.Unix(1577880000, 0).UTC())))
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "metrics-*.lp.gz"))
+	assert.Len(t, rotated, 2)
+
+	current, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(current), "# DML\n# CONTEXT-DATABASE: db\n"))
+
+	f, err := os.Open(rotated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, string(current), string(data))
+}
+
+func TestReplayer_ReplayFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		format FileFormat
+		want   interface{}
+	}{
+		{name: "json lines", format: JSONLines, want: 1.0},
+		{name: "line protocol", format: LineProtocol, want: int64(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(tt.format))
+			s := NewFileSink(FileConfig{Path: path, Format: tt.format, Precision: "s", Database: "db"})
+			assert.NoError(t, s.Write(context.Background(), testBatch(2, time.Unix(1577880000, 0).UTC())))
+			assert.NoError(t, s.Write(context.Background(), testBatch(2, time.Unix(1577880000, 0).UTC())))
+			assert.NoError(t, s.(*fileSink).Close())
+
+			var batches []Batch
+			r := Replayer{
+				Sink: &testSink{writeCall: func(_ context.Context, batch Batch) error {
+					batches = append(batches, batch)
+					return nil
+				}},
+				BatchSize: 3,
+				Precision: "s",
+			}
+			assert.NoError(t, r.ReplayFile(context.Background(), path))
+
+			if !assert.Len(t, batches, 2) {
+				return
+			}
+			assert.Len(t, batches[0].Points, 3)
+			assert.Len(t, batches[1].Points, 1)
+
+			p := batches[0].Points[1]
+			assert.Equal(t, "measure", p.Measurement)
+			assert.Equal(t, tt.want, p.Fields["value"])
+			assert.True(t, time.Unix(1577880000, 0).Equal(p.Time))
+		})
+	}
+}
+
+func TestReplayer_Replay_parseError(t *testing.T) {
+	var points int
+	r := Replayer{Sink: &testSink{writeCall: func(_ context.Context, batch Batch) error {
+		points += len(batch.Points)
+		return nil
+	}}}
+	input := "measure value=1i 1577880000000000000\nbroken\nmeasure value=2i 1577880000000000000\n"
+
+	assert.Error(t, r.Replay(context.Background(), strings.NewReader(input)))
+
+	var lines []int
+	points = 0
+	r.OnParseError = func(line int, err error) {
+		lines = append(lines, line)
+	}
+	assert.NoError(t, r.Replay(context.Background(), strings.NewReader(input)))
+	assert.Equal(t, []int{2}, lines)
+	assert.Equal(t, 2, points)
+}
+
+func Test_rotatedName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.jsonl")
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	first := rotatedName(path, now)
+	assert.Equal(t, filepath.Join(dir, "metrics-20200101T120000.000.jsonl"), first)
+
+	assert.NoError(t, ioutil.WriteFile(first+".gz", nil, 0644))
+	assert.Equal(t, filepath.Join(dir, "metrics-20200101T120000.000-1.jsonl"), rotatedName(path, now))
+}
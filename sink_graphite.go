@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// DefaultGraphiteTemplate is the template used to build the Graphite paths if none is configured.
+const DefaultGraphiteTemplate = "{measurement}.{tags}.{field}.{bucket}"
+
+// DefaultPickleFrameSize is the default maximum size of a pickle frame. Carbon drops larger frames (MAX_LENGTH).
+const DefaultPickleFrameSize = 1 << 20
+
+var errGraphiteNotConnected = errors.New("graphite: not connected")
+
+// GraphiteConfig holds the settings of a Graphite sink.
+type GraphiteConfig struct {
+	// Addr is the address of the carbon receiver (host:port).
+	Addr string
+	// Prefix is prepended to all paths.
+	Prefix string
+	// Template defines how a data point is flattened to a dotted path. Placeholders are
+	// {measurement}, {field} (name and suffix of the metric), {bucket}, {tags} (all tag values
+	// not used otherwise, sorted by key) and {<tag key>}. Empty parts are left out.
+	// Defaults to DefaultGraphiteTemplate.
+	Template string
+	// Tagged sends Graphite 1.1 tagged series (`measurement.field;tag=value`) instead of using the template.
+	Tagged bool
+	// Pickle uses the pickle protocol instead of the plaintext protocol.
+	Pickle bool
+	// PickleFrameSize is the maximum size of a pickle frame: a batch is split into frames up to this size.
+	// Defaults to DefaultPickleFrameSize.
+	PickleFrameSize int
+	// DialTimeout limits the time to connect to carbon. Defaults to 5 seconds.
+	DialTimeout time.Duration
+}
+
+// NewGraphiteSink creates a sink sending the data points to Graphite/Carbon over TCP.
+func NewGraphiteSink(conf GraphiteConfig) Sink {
+	if conf.Template == "" {
+		conf.Template = DefaultGraphiteTemplate
+	}
+	if conf.DialTimeout == 0 {
+		conf.DialTimeout = 5 * time.Second
+	}
+	if conf.PickleFrameSize == 0 {
+		conf.PickleFrameSize = DefaultPickleFrameSize
+	}
+	return &graphiteSink{
+		conf:     conf,
+		template: strings.Split(conf.Template, "."),
+	}
+}
+
+type graphiteMetric struct {
+	path  string
+	value float64
+	time  int64
+}
+
+// graphiteSink implements a Sink writing to Graphite/Carbon.
+type graphiteSink struct {
+	conf     GraphiteConfig
+	template []string
+
+	m    sync.Mutex
+	conn net.Conn
+}
+
+// Open connects to carbon if there is no connection yet.
+func (s *graphiteSink) Open() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.open()
+}
+
+func (s *graphiteSink) open() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", s.conf.Addr, s.conf.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// Ping checks if the connection to carbon is still open. Carbon does not answer, so a
+// closed connection is detected by reading from it.
+func (s *graphiteSink) Ping() (time.Duration, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn == nil {
+		return 0, errGraphiteNotConnected
+	}
+
+	now := time.Now()
+	_ = s.conn.SetReadDeadline(now.Add(time.Millisecond))
+	_, err := s.conn.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return time.Since(now), nil
+	}
+
+	s.close()
+	if err == nil {
+		err = errors.New("graphite: unexpected data received")
+	}
+	return 0, err
+}
+
+// Write sends the batch to carbon. The connection is closed if the write fails and
+// re-opened by the next write or ping of the reporter.
+func (s *graphiteSink) Write(ctx context.Context, batch Batch) error {
+	data := s.encode(s.metrics(batch))
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	if _, err := s.conn.Write(data); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *graphiteSink) close() {
+	if s.conn == nil {
+		return
+	}
+	_ = s.conn.Close()
+	s.conn = nil
+}
+
+func (s *graphiteSink) metrics(batch Batch) []graphiteMetric {
+	var ms []graphiteMetric
+	for _, pt := range batch.Points {
+		ts := pt.Time
+		if ts.IsZero() {
+			ts = batch.Time
+		}
+
+		fields := make([]string, 0, len(pt.Fields))
+		for field := range pt.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			value, ok := floatValue(pt.Fields[field])
+			if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			ms = append(ms, graphiteMetric{
+				path:  s.path(pt, field),
+				value: value,
+				time:  ts.Unix(),
+			})
+		}
+	}
+	return ms
+}
+
+func (s *graphiteSink) path(pt client.Point, field string) string {
+	if s.conf.Tagged {
+		return s.taggedPath(pt, field)
+	}
+
+	used := make(map[string]bool, len(s.template))
+	for _, part := range s.template {
+		used[strings.Trim(part, "{}")] = true
+	}
+
+	parts := make([]string, 0, len(s.template)+len(pt.Tags)+1)
+	if s.conf.Prefix != "" {
+		parts = append(parts, s.conf.Prefix)
+	}
+	for _, part := range s.template {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			parts = append(parts, part)
+			continue
+		}
+
+		switch key := part[1 : len(part)-1]; key {
+		case "measurement":
+			parts = append(parts, graphiteNode(pt.Measurement))
+		case "field":
+			parts = append(parts, field)
+		case "tags":
+			for _, k := range sortedKeys(pt.Tags) {
+				if !used[k] {
+					parts = append(parts, graphiteNode(pt.Tags[k]))
+				}
+			}
+		default:
+			parts = append(parts, graphiteNode(pt.Tags[key]))
+		}
+	}
+
+	path := parts[:0]
+	for _, part := range parts {
+		if part != "" {
+			path = append(path, part)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// taggedPath builds a Graphite 1.1 tagged series: `measurement.field;tag1=value1;tag2=value2`.
+func (s *graphiteSink) taggedPath(pt client.Point, field string) string {
+	var b strings.Builder
+	if s.conf.Prefix != "" {
+		b.WriteString(s.conf.Prefix + ".")
+	}
+	b.WriteString(graphiteNode(pt.Measurement) + "." + field)
+
+	for _, k := range sortedKeys(pt.Tags) {
+		if v := pt.Tags[k]; v != "" {
+			b.WriteString(";" + graphiteTagReplacer.Replace(k) + "=" + graphiteTagReplacer.Replace(v))
+		}
+	}
+	return b.String()
+}
+
+func (s *graphiteSink) encode(ms []graphiteMetric) []byte {
+	if len(ms) == 0 {
+		return nil
+	}
+	if s.conf.Pickle {
+		return encodePickle(ms, s.conf.PickleFrameSize)
+	}
+
+	var b bytes.Buffer
+	for _, m := range ms {
+		b.WriteString(m.path)
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(m.value, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(m.time, 10))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// encodePickle encodes the metrics as pickled lists of `(path, (timestamp, value))` tuples
+// (pickle protocol 2), each prefixed with its length as carbon expects it. The metrics are split
+// into frames of up to frameSize bytes. A metric exceeding the size is sent in a frame of its own.
+func encodePickle(ms []graphiteMetric, frameSize int) []byte {
+	var (
+		b     bytes.Buffer
+		frame = -1 // start of the current frame
+		buf   [8]byte
+	)
+	for _, m := range ms {
+		// BINUNICODE with path, BININT, BINFLOAT and two TUPLE2
+		size := 1 + 4 + len(m.path) + 1 + 4 + 1 + 8 + 2
+		if frame >= 0 && b.Len()-frame-4+size+2 > frameSize {
+			endPickleFrame(&b, frame)
+			frame = -1
+		}
+		if frame < 0 {
+			frame = b.Len()
+			b.Write([]byte{0, 0, 0, 0}) // length header
+			b.Write([]byte{0x80, 2})    // PROTO 2
+			b.WriteByte(']')            // EMPTY_LIST
+			b.WriteByte('(')            // MARK
+		}
+
+		b.WriteByte('X') // BINUNICODE
+		binary.LittleEndian.PutUint32(buf[:4], uint32(len(m.path)))
+		b.Write(buf[:4])
+		b.WriteString(m.path)
+
+		b.WriteByte('J') // BININT
+		binary.LittleEndian.PutUint32(buf[:4], uint32(int32(m.time)))
+		b.Write(buf[:4])
+
+		b.WriteByte('G') // BINFLOAT
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(m.value))
+		b.Write(buf[:])
+
+		b.WriteByte(0x86) // TUPLE2 (timestamp, value)
+		b.WriteByte(0x86) // TUPLE2 (path, (timestamp, value))
+	}
+	if frame >= 0 {
+		endPickleFrame(&b, frame)
+	}
+	return b.Bytes()
+}
+
+// endPickleFrame closes the list of the frame starting at the given offset and sets its length header.
+func endPickleFrame(b *bytes.Buffer, frame int) {
+	b.WriteByte('e') // APPENDS
+	b.WriteByte('.') // STOP
+
+	data := b.Bytes()[frame:]
+	binary.BigEndian.PutUint32(data[:4], uint32(len(data)-4))
+}
+
+var (
+	graphiteNodeReplacer = strings.NewReplacer(".", "_", " ", "_")
+	graphiteTagReplacer  = strings.NewReplacer(";", "_", "=", "_", " ", "_")
+)
+
+// graphiteNode replaces characters which would split a value into multiple nodes.
+func graphiteNode(s string) string {
+	return graphiteNodeReplacer.Replace(s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
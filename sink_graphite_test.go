@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_graphiteSink_path(t *testing.T) {
+	pt := getPoint("measure", map[string]interface{}{"testTimer.timer": 1.0},
+		map[string]string{"host": "srv.1", "bucket": "p99", "dc": "eu"})
+
+	tests := []struct {
+		name string
+		conf GraphiteConfig
+		want string
+	}{
+		{
+			name: "default template",
+			conf: GraphiteConfig{},
+			want: "measure.eu.srv_1.testTimer.timer.p99",
+		},
+		{
+			name: "custom template with prefix",
+			conf: GraphiteConfig{Prefix: "app", Template: "{host}.{measurement}.{field}.{bucket}"},
+			want: "app.srv_1.measure.testTimer.timer.p99",
+		},
+		{
+			name: "missing tag is left out",
+			conf: GraphiteConfig{Template: "{measurement}.{region}.{field}"},
+			want: "measure.testTimer.timer",
+		},
+		{
+			name: "tagged",
+			conf: GraphiteConfig{Tagged: true},
+			want: "measure.testTimer.timer;bucket=p99;dc=eu;host=srv.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGraphiteSink(tt.conf).(*graphiteSink)
+			assert.Equal(t, tt.want, s.path(pt, "testTimer.timer"))
+		})
+	}
+}
+
+func Test_graphiteSink_Write(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	s := NewGraphiteSink(GraphiteConfig{Addr: l.Addr().String(), Template: "{measurement}.{field}"})
+	err = s.Write(context.Background(), Batch{
+		Points: []client.Point{
+			getPoint("measure", map[string]interface{}{"testGauge.gauge": int64(5)}, nil),
+			getPoint("measure", map[string]interface{}{"text": "skipped"}, nil),
+		},
+		Time: time.Unix(1577880000, 0),
+	})
+	assert.NoError(t, err)
+
+	select {
+	case line := <-lines:
+		assert.Equal(t, "measure.testGauge.gauge 5 1577880000", line)
+	case <-time.After(time.Second):
+		t.Fatal("no data received")
+	}
+
+	_, err = s.(Pinger).Ping()
+	assert.NoError(t, err)
+}
+
+func Test_graphiteSink_reconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	s := NewGraphiteSink(GraphiteConfig{Addr: l.Addr().String()})
+	assert.NoError(t, s.(Opener).Open())
+
+	conn := <-conns
+	_ = conn.Close()
+
+	// the closed connection is detected by the ping and re-opened
+	time.Sleep(10 * time.Millisecond)
+	_, err = s.(Pinger).Ping()
+	assert.Error(t, err)
+	assert.NoError(t, s.(Opener).Open())
+
+	select {
+	case conn = <-conns:
+		_ = conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("sink did not reconnect")
+	}
+}
+
+func Test_encodePickle(t *testing.T) {
+	data := encodePickle([]graphiteMetric{{path: "a.b", value: 1.5, time: 10}}, DefaultPickleFrameSize)
+
+	size := binary.BigEndian.Uint32(data[:4])
+	assert.Equal(t, len(data)-4, int(size))
+
+	want := []byte{0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'J', 10, 0, 0, 0,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86, 'e', '.'}
+	assert.Equal(t, want, data[4:])
+}
+
+func Test_encodePickle_frames(t *testing.T) {
+	ms := make([]graphiteMetric, 5)
+	for i := range ms {
+		ms[i] = graphiteMetric{path: "a.b", value: float64(i), time: 10}
+	}
+	// a frame holds 2 metrics: 6 bytes of the list and 24 bytes per metric
+	data := encodePickle(ms, 6+2*24)
+
+	var frames [][]byte
+	for len(data) != 0 {
+		size := binary.BigEndian.Uint32(data[:4])
+		frames = append(frames, data[4:4+size])
+		data = data[4+size:]
+	}
+	if assert.Len(t, frames, 3) {
+		assert.Len(t, frames[0], 6+2*24)
+		assert.Len(t, frames[2], 6+24)
+		for _, frame := range frames {
+			assert.Equal(t, []byte{0x80, 2, ']', '('}, frame[:4])
+			assert.Equal(t, []byte{'e', '.'}, frame[len(frame)-2:])
+		}
+	}
+
+	// a metric exceeding the size is sent on its own
+	data = encodePickle(ms[:2], 10)
+	assert.Len(t, data, 2*(4+6+24))
+}
+
+func Test_graphiteSink_pickle(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		received <- payload
+	}()
+
+	s := NewGraphiteSink(GraphiteConfig{Addr: l.Addr().String(), Pickle: true})
+	err = s.Write(context.Background(), testBatch(1, time.Unix(10, 0)))
+	assert.NoError(t, err)
+
+	select {
+	case payload := <-received:
+		assert.Equal(t, byte('.'), payload[len(payload)-1])
+	case <-time.After(time.Second):
+		t.Fatal("no data received")
+	}
+}
@@ -0,0 +1,292 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+)
+
+// InfluxConfig holds the connection settings of an InfluxDB sink.
+type InfluxConfig struct {
+	URL  url.URL
+	DB   string
+	User string
+	Pass string
+	// RetentionPolicy to write to. Defaults to the default retention policy of the database.
+	RetentionPolicy string
+	// WriteConsistency (any, one, quorum or all) of InfluxDB Enterprise clusters.
+	WriteConsistency string
+	// Precision of the timestamps (s, ms, us or ns). Defaults to ns.
+	Precision string
+
+	// InfluxDB 2.x settings
+	V2     bool
+	Org    string
+	Bucket string
+	Token  string
+	Gzip   bool
+
+	// PayloadSize is the maximum size of a packet when writing via UDP (`udp://host:port`).
+	// Defaults to DefaultUDPPayloadSize.
+	PayloadSize int
+
+	// Timeout limits the time of a request. Defaults to DefaultInfluxTimeout.
+	Timeout time.Duration
+	// UserAgent is sent with every request.
+	UserAgent string
+	// CAFile is a PEM encoded CA bundle used to verify the server certificate.
+	CAFile string
+	// CertFile and KeyFile hold a PEM encoded client certificate and its key.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
+	// TLS is the base TLS configuration the settings above are added to.
+	TLS *tls.Config
+	// Proxy returns the proxy to use for a request. Defaults to http.ProxyFromEnvironment.
+	Proxy func(req *http.Request) (*url.URL, error)
+	// HTTPClient replaces the client built from the settings above.
+	HTTPClient *http.Client
+}
+
+// DefaultInfluxTimeout is the default timeout of a request to InfluxDB.
+const DefaultInfluxTimeout = 10 * time.Second
+
+func (c InfluxConfig) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultInfluxTimeout
+	}
+	return c.Timeout
+}
+
+func (c InfluxConfig) proxy() func(req *http.Request) (*url.URL, error) {
+	if c.Proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+	return c.Proxy
+}
+
+// tlsConfig builds the TLS configuration and loads the CA bundle and the client certificate.
+func (c InfluxConfig) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{}
+	if c.TLS != nil {
+		conf = c.TLS.Clone()
+	}
+	if c.InsecureSkipVerify {
+		conf.InsecureSkipVerify = true
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", c.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		conf.Certificates = append(conf.Certificates, cert)
+	}
+	return conf, nil
+}
+
+// httpClient returns HTTPClient or builds one from the timeout, TLS and proxy settings.
+func (c InfluxConfig) httpClient() (*http.Client, error) {
+	if c.HTTPClient != nil {
+		return c.HTTPClient, nil
+	}
+
+	tlsConf, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout: c.timeout(),
+		Transport: &http.Transport{
+			Proxy:           c.proxy(),
+			TLSClientConfig: tlsConf,
+		},
+	}, nil
+}
+
+// NewInfluxSink creates a sink sending the data points to InfluxDB.
+// It is the sink used by NewReporter and NewReporterV2 and can be used
+// to add further InfluxDB servers to a reporter.
+func NewInfluxSink(conf InfluxConfig) Sink {
+	return &influxSink{server: conf}
+}
+
+// influxSink implements a Sink writing to InfluxDB.
+type influxSink struct {
+	server InfluxConfig
+
+	m      sync.Mutex
+	client dbClient
+	// stale is set by a failed ping: the client is rebuilt when the sink is opened again.
+	stale bool
+}
+
+// Open creates the InfluxDB client. A client that failed to ping is replaced by a new one.
+func (s *influxSink) Open() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.client != nil && !s.stale {
+		return nil
+	}
+	c, err := s.newClient()
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := s.client.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	s.client, s.stale = c, false
+	return nil
+}
+
+// conn returns the InfluxDB client. It is created on first use if the sink was not opened.
+func (s *influxSink) conn() (dbClient, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+	c, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+	s.client = c
+	return c, nil
+}
+
+func (s *influxSink) newClient() (dbClient, error) {
+	switch s.server.Precision {
+	case "", "s", "ms", "us", "ns":
+	default:
+		return nil, fmt.Errorf("invalid precision %q: use s, ms, us or ns", s.server.Precision)
+	}
+	switch s.server.WriteConsistency {
+	case "", "any", "one", "quorum", "all":
+	default:
+		return nil, fmt.Errorf("invalid write consistency %q: use any, one, quorum or all", s.server.WriteConsistency)
+	}
+
+	if s.server.URL.Scheme == "udp" {
+		return newUDPClient(s.server)
+	}
+
+	httpClient, err := s.server.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if s.server.V2 {
+		return newV2Client(s.server, httpClient), nil
+	}
+	return newV1Client(s.server, httpClient), nil
+}
+
+// Write sends the batch to InfluxDB. The points of measurements with their own retention
+// policy (see WithRetentionPolicy) are written with a separate request.
+// The requests are cancelled with the context.
+func (s *influxSink) Write(ctx context.Context, batch Batch) error {
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range s.groupByRetentionPolicy(batch) {
+		bps := client.BatchPoints{
+			Points:           group.points,
+			Database:         s.server.DB,
+			RetentionPolicy:  group.rp,
+			Precision:        s.precision(),
+			WriteConsistency: s.server.WriteConsistency,
+			Time:             batch.Time,
+		}
+		if _, err := c.Write(ctx, bps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// precision returns the precision as expected by the write API: InfluxDB 1.x
+// takes `u` and `n` instead of `us` and `ns` while InfluxDB 2.x takes only the latter.
+func (s *influxSink) precision() string {
+	if s.server.V2 {
+		return s.server.Precision
+	}
+	return lineProtocolPrecision(s.server.Precision)
+}
+
+type rpGroup struct {
+	rp     string
+	points []client.Point
+}
+
+// groupByRetentionPolicy groups the points by retention policy, in the order the retention
+// policies first occur. The points get the time of the batch and the precision of the sink.
+func (s *influxSink) groupByRetentionPolicy(batch Batch) []rpGroup {
+	var (
+		groups  []rpGroup
+		indexes = make(map[string]int, 1)
+	)
+	for _, p := range batch.Points {
+		rp, ok := batch.RetentionPolicies[p.Measurement]
+		if !ok || s.server.V2 || s.server.URL.Scheme == "udp" {
+			rp = s.server.RetentionPolicy
+		}
+
+		i, ok := indexes[rp]
+		if !ok {
+			i = len(groups)
+			indexes[rp] = i
+			groups = append(groups, rpGroup{rp: rp, points: make([]client.Point, 0, len(batch.Points))})
+		}
+
+		if p.Time.IsZero() {
+			p.Time = batch.Time
+		}
+		p.Precision = lineProtocolPrecision(s.server.Precision)
+		groups[i].points = append(groups[i].points, p)
+	}
+	return groups
+}
+
+// Ping sends a ping to InfluxDB and returns the round trip time.
+func (s *influxSink) Ping() (time.Duration, error) {
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+
+	rtt, _, err := c.Ping()
+	if err != nil {
+		s.m.Lock()
+		if s.client == c {
+			s.stale = true
+		}
+		s.m.Unlock()
+	}
+	return rtt, err
+}
@@ -0,0 +1,351 @@
+package metrics
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_influxSink_Write(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{
+			name: "write",
+		},
+		{
+			name:    "write error",
+			err:     errors.New("write failed"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &influxSink{
+				server: InfluxConfig{DB: "testDB"},
+				client: &testClient{
+					writeCall: func(points client.BatchPoints) (*client.Response, error) {
+						assert.Equal(t, "testDB", points.Database)
+						assert.Equal(t, now, points.Time)
+						assert.Equal(t, 1, len(points.Points))
+						return nil, tt.err
+					},
+				},
+			}
+
+			err := sink.Write(context.Background(), testBatch(1, now))
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_influxSink_Ping(t *testing.T) {
+	sink := NewInfluxSink(InfluxConfig{}).(*influxSink)
+	sink.client = &testClient{
+		pingCall: func() (time.Duration, string, error) {
+			return time.Millisecond, "1.8", nil
+		},
+	}
+
+	rtt, err := sink.Ping()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Millisecond, rtt)
+}
+
+func Test_influxSink_Open_reconnect(t *testing.T) {
+	u, _ := url.Parse("http://localhost:8086")
+	sink := NewInfluxSink(InfluxConfig{URL: *u, DB: "testDB"}).(*influxSink)
+	sink.client = &testClient{
+		pingCall: func() (time.Duration, string, error) {
+			return 0, "", errors.New("connection refused")
+		},
+	}
+
+	_, err := sink.Ping()
+	assert.Error(t, err)
+
+	require.NoError(t, sink.Open())
+	assert.IsType(t, &v1Client{}, sink.client)
+}
+
+func Test_influxSink_Write_concurrentOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	sink := NewInfluxSink(InfluxConfig{URL: *u, DB: "testDB"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sink.Write(context.Background(), testBatch(1, time.Unix(1577880000, 0))))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sink.(Opener).Open())
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_influxSink_TLS(t *testing.T) {
+	var userAgent = make(chan string, 10)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		userAgent <- req.UserAgent()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	dir, err := ioutil.TempDir("", "metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, ca, 0600))
+
+	tests := []struct {
+		name    string
+		conf    InfluxConfig
+		wantErr bool
+	}{
+		{name: "unknown authority", conf: InfluxConfig{URL: *u}, wantErr: true},
+		{name: "CA bundle", conf: InfluxConfig{URL: *u, CAFile: caFile, UserAgent: "test-agent"}},
+		{name: "insecure", conf: InfluxConfig{URL: *u, InsecureSkipVerify: true, UserAgent: "test-agent"}},
+		{name: "v2 with CA bundle", conf: InfluxConfig{URL: *u, V2: true, CAFile: caFile, UserAgent: "test-agent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewInfluxSink(tt.conf).Write(context.Background(), testBatch(1, time.Unix(1577880000, 0)))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "test-agent", <-userAgent)
+		})
+	}
+
+	err = NewInfluxSink(InfluxConfig{URL: *u, CAFile: filepath.Join(dir, "missing.pem")}).(Opener).Open()
+	assert.Error(t, err)
+}
+
+func Test_influxSink_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	start := time.Now()
+	err := NewInfluxSink(InfluxConfig{URL: *u, Timeout: 20 * time.Millisecond}).Write(context.Background(), testBatch(1, time.Unix(1577880000, 0)))
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+}
+
+func Test_influxSink_Write_context(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	for _, conf := range []InfluxConfig{{URL: *u}, {URL: *u, V2: true}} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		err := NewInfluxSink(conf).Write(ctx, testBatch(1, time.Unix(1577880000, 0)))
+		cancel()
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "v2=%v: %v", conf.V2, err)
+		assert.True(t, time.Since(start) < 200*time.Millisecond)
+	}
+}
+
+func Test_influxSink_HTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ping":
+			w.Header().Set("X-Influxdb-Version", "1.8.0")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/write":
+		default:
+			t.Errorf("unexpected path %s", req.URL.Path)
+		}
+
+		user, pass, _ := req.BasicAuth()
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "pass", pass)
+		assert.Equal(t, "testDB", req.URL.Query().Get("db"))
+		assert.Equal(t, "via-client", req.Header.Get("X-Test"))
+
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "measure value=0i 1577880000000000000\n", string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	httpClient := &http.Client{Transport: headerTransport{key: "X-Test", value: "via-client"}}
+	rep := NewReporter(srv.URL, "testDB", Auth("user", "pass"), HTTPClient(httpClient),
+		Registry(metrics.NewRegistry()))
+	assert.Equal(t, httpClient, rep.(*reporter).server.HTTPClient)
+
+	sink := NewInfluxSink(InfluxConfig{URL: *u, DB: "testDB", User: "user", Pass: "pass", HTTPClient: httpClient})
+	require.NoError(t, sink.Write(context.Background(), testBatch(1, time.Unix(1577880000, 0))))
+
+	_, err := sink.(Pinger).Ping()
+	assert.NoError(t, err)
+}
+
+type headerTransport struct {
+	key, value string
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_influxSink_RetentionPolicy(t *testing.T) {
+	var written []client.BatchPoints
+	sink := &influxSink{
+		server: InfluxConfig{DB: "testDB", RetentionPolicy: "default_rp", Precision: "s", WriteConsistency: "quorum"},
+		client: &testClient{writeCall: func(bp client.BatchPoints) (*client.Response, error) {
+			written = append(written, bp)
+			return nil, nil
+		}},
+	}
+
+	batch := Batch{
+		Points: []client.Point{
+			getPoint("measure", map[string]interface{}{"value": 1}, nil),
+			getPoint("highres", map[string]interface{}{"value": 2}, nil),
+			getPoint("measure", map[string]interface{}{"value": 3}, nil),
+		},
+		Time:              time.Unix(1577880000, 0),
+		RetentionPolicies: map[string]string{"highres": "one_day"},
+	}
+	require.NoError(t, sink.Write(context.Background(), batch))
+
+	require.Len(t, written, 2)
+	assert.Equal(t, "default_rp", written[0].RetentionPolicy)
+	assert.Len(t, written[0].Points, 2)
+	assert.Equal(t, "one_day", written[1].RetentionPolicy)
+	assert.Len(t, written[1].Points, 1)
+
+	for _, bp := range written {
+		assert.Equal(t, "testDB", bp.Database)
+		assert.Equal(t, "s", bp.Precision)
+		assert.Equal(t, "quorum", bp.WriteConsistency)
+		for _, p := range bp.Points {
+			assert.Equal(t, batch.Time, p.Time)
+			assert.Equal(t, "s", p.Precision)
+		}
+	}
+	assert.True(t, batch.Points[0].Time.IsZero(), "the points of the batch must not be modified")
+
+	// the retention policy of InfluxDB 2.x is defined by the bucket
+	written = nil
+	sink.server.V2 = true
+	require.NoError(t, sink.Write(context.Background(), batch))
+	require.Len(t, written, 1)
+}
+
+func Test_influxSink_Precision(t *testing.T) {
+	type request struct {
+		precision string
+		body      string
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		requests <- request{precision: req.URL.Query().Get("precision"), body: string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		precision string
+		v1        string
+		v2        string
+		timestamp string
+	}{
+		{precision: "", v1: "", v2: "", timestamp: "1577880000000000000"},
+		{precision: "s", v1: "s", v2: "s", timestamp: "1577880000"},
+		{precision: "ms", v1: "ms", v2: "ms", timestamp: "1577880000000"},
+		{precision: "us", v1: "u", v2: "us", timestamp: "1577880000000000"},
+		{precision: "ns", v1: "n", v2: "ns", timestamp: "1577880000000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.precision, func(t *testing.T) {
+			require.NoError(t, NewInfluxSink(InfluxConfig{URL: *u, Precision: tt.precision}).Write(context.Background(), testBatch(1, time.Unix(1577880000, 0))))
+			req := <-requests
+			assert.Equal(t, tt.v1, req.precision)
+			assert.Equal(t, "measure value=0i "+tt.timestamp+"\n", req.body)
+
+			require.NoError(t, NewInfluxSink(InfluxConfig{URL: *u, V2: true, Precision: tt.precision}).Write(context.Background(), testBatch(1, time.Unix(1577880000, 0))))
+			req = <-requests
+			assert.Equal(t, tt.v2, req.precision)
+			assert.Equal(t, "measure value=0i "+tt.timestamp+"\n", req.body)
+		})
+	}
+}
+
+func Test_influxSink_Open_invalid(t *testing.T) {
+	assert.EqualError(t, NewInfluxSink(InfluxConfig{Precision: "h"}).(Opener).Open(),
+		`invalid precision "h": use s, ms, us or ns`)
+	assert.EqualError(t, NewInfluxSink(InfluxConfig{WriteConsistency: "most"}).(Opener).Open(),
+		`invalid write consistency "most": use any, one, quorum or all`)
+}
+
+func TestWithRetentionPolicy(t *testing.T) {
+	var written []client.BatchPoints
+	rep := NewReporter("http://localhost:8086", "testDB",
+		Registry(metrics.NewRegistry()),
+		RetentionPolicy("default_rp"),
+		Precision("ms"),
+		withDBClient(&testClient{writeCall: func(bp client.BatchPoints) (*client.Response, error) {
+			written = append(written, bp)
+			return nil, nil
+		}}),
+	)
+	NewGauge("gauge", WithReporter(rep)).Update(1)
+	NewGauge("gauge", WithReporter(rep), WithMeasurement("highres"), WithRetentionPolicy("one_day")).Update(2)
+
+	require.NoError(t, rep.(Shutdowner).Shutdown(context.Background()))
+	require.Len(t, written, 2)
+
+	rps := map[string]string{}
+	for _, bp := range written {
+		require.Len(t, bp.Points, 1)
+		rps[bp.Points[0].Measurement] = bp.RetentionPolicy
+		assert.Equal(t, "ms", bp.Precision)
+	}
+	assert.Equal(t, map[string]string{"default": "default_rp", "highres": "one_day"}, rps)
+}
@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otlpGauge = iota
+	// otlpSum is a monotonic sum.
+	otlpSum
+	otlpSummary
+	otlpHistogram
+)
+
+// OTLPConfig holds the settings of an OTLP sink.
+type OTLPConfig struct {
+	// Endpoint is the URL of the OTLP/HTTP metrics endpoint, e.g. http://localhost:4318/v1/metrics.
+	Endpoint string
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string
+	// JSON sends the metrics JSON encoded instead of protobuf encoded.
+	JSON bool
+	// ResourceAttributes are added to the resource in addition to the tags of the reporter (e.g. service.name).
+	ResourceAttributes map[string]string
+	// HTTPClient is used to send the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewOTLPSink creates a sink exporting the metrics to an OpenTelemetry collector via OTLP/HTTP.
+// Counters become cumulative sums, gauges become gauges, timers and histograms become
+// summaries and bucket histograms become histograms. Tags of the metrics become attributes, the tags of the reporter resource attributes.
+func NewOTLPSink(conf OTLPConfig) Sink {
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	return &otlpSink{
+		conf:  conf,
+		start: time.Now(),
+	}
+}
+
+// otlpSink implements a Sink writing to an OTLP/HTTP endpoint.
+type otlpSink struct {
+	conf  OTLPConfig
+	start time.Time
+}
+
+type otlpAttribute struct {
+	key   string
+	value string
+}
+
+type otlpQuantile struct {
+	quantile float64
+	value    float64
+}
+
+type otlpDataPoint struct {
+	attributes []otlpAttribute
+	start      int64
+	time       int64
+
+	// gauge and sum
+	value float64
+
+	// summary and histogram
+	count     uint64
+	sum       float64
+	mean      float64
+	quantiles []otlpQuantile
+	buckets   []otlpBucket
+}
+
+// otlpBucket is a bucket of a histogram with its upper bound and count.
+type otlpBucket struct {
+	bound float64
+	count uint64
+}
+
+type otlpMetric struct {
+	name   string
+	unit   string
+	kind   int
+	points []*otlpDataPoint
+}
+
+type otlpExport struct {
+	resource []otlpAttribute
+	metrics  []*otlpMetric
+}
+
+// Write converts the batch to OTLP and posts it to the endpoint.
+func (s *otlpSink) Write(ctx context.Context, batch Batch) error {
+	export := s.convert(batch)
+	if len(export.metrics) == 0 {
+		return nil
+	}
+
+	var (
+		body        []byte
+		contentType = "application/x-protobuf"
+	)
+	if s.conf.JSON {
+		contentType = "application/json"
+		body = export.marshalJSON()
+	} else {
+		body = export.marshalProto()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.conf.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.conf.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("otlp export failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// convert groups the data points of the batch to OTLP metrics. The kind of metric is derived
+// from the suffix of the field name, the bucket tag selects the value of timers, histograms and meters.
+func (s *otlpSink) convert(batch Batch) otlpExport {
+	var (
+		export = otlpExport{
+			resource: otlpAttributes(composeTags(batch.Tags, s.conf.ResourceAttributes), nil),
+		}
+		metrics = make(map[string]*otlpMetric)
+		series  = make(map[string]*otlpDataPoint)
+		start   = s.start.UnixNano()
+	)
+
+	for _, pt := range batch.Points {
+		ts := pt.Time
+		if ts.IsZero() {
+			ts = batch.Time
+		}
+		attrs := otlpAttributes(pt.Tags, batch.Tags)
+
+		for field, v := range pt.Fields {
+			value, ok := floatValue(v)
+			if !ok {
+				continue
+			}
+
+			bucket := pt.Tags["bucket"]
+			name, unit, kind := otlpDescribe(pt.Measurement, field, bucket)
+			dpAttrs := attrs
+			if kind == otlpHistogram {
+				// the buckets of a histogram are one data point
+				dpAttrs = otlpWithout(attrs, leTag)
+			}
+			m, ok := metrics[name]
+			if !ok {
+				m = &otlpMetric{name: name, unit: unit, kind: kind}
+				metrics[name] = m
+				export.metrics = append(export.metrics, m)
+			}
+
+			key := name + otlpSeriesKey(dpAttrs)
+			dp, ok := series[key]
+			if !ok || kind != otlpSummary && kind != otlpHistogram {
+				dp = &otlpDataPoint{attributes: dpAttrs, start: start, time: ts.UnixNano()}
+				series[key] = dp
+				m.points = append(m.points, dp)
+			}
+
+			switch kind {
+			case otlpSummary:
+				dp.addSummaryValue(bucket, value)
+			case otlpHistogram:
+				dp.addHistogramValue(bucket, pt.Tags[leTag], value)
+			default:
+				dp.value = value
+			}
+		}
+	}
+
+	for _, m := range export.metrics {
+		for _, dp := range m.points {
+			switch m.kind {
+			case otlpSummary:
+				dp.sum = dp.mean * float64(dp.count)
+				sort.Slice(dp.quantiles, func(i, j int) bool {
+					return dp.quantiles[i].quantile < dp.quantiles[j].quantile
+				})
+			case otlpHistogram:
+				dp.decumulate()
+			}
+		}
+	}
+	sort.Slice(export.metrics, func(i, j int) bool {
+		return export.metrics[i].name < export.metrics[j].name
+	})
+	return export
+}
+
+var otlpQuantileBuckets = map[string]float64{
+	min: 0, p50: 0.5, p75: 0.75, p95: 0.95, p99: 0.99, p999: 0.999, p9999: 0.9999, max: 1,
+}
+
+func (dp *otlpDataPoint) addSummaryValue(bucket string, value float64) {
+	switch bucket {
+	case count:
+		dp.count = uint64(value)
+	case mean:
+		dp.mean = value
+	default:
+		if q, ok := otlpQuantileBuckets[bucket]; ok {
+			dp.quantiles = append(dp.quantiles, otlpQuantile{quantile: q, value: value})
+		}
+	}
+}
+
+// addHistogramValue adds the cumulative count of a bucket, tagged with its upper bound, or the sum or count.
+func (dp *otlpDataPoint) addHistogramValue(bucket, le string, value float64) {
+	switch bucket {
+	case count:
+		dp.count = uint64(value)
+	case sum:
+		dp.sum = value
+	case "":
+		bound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			return
+		}
+		dp.buckets = append(dp.buckets, otlpBucket{bound: bound, count: uint64(value)})
+	}
+}
+
+// decumulate sorts the buckets by their upper bound and converts the cumulative
+// counts to the counts of the single buckets as expected by OTLP.
+func (dp *otlpDataPoint) decumulate() {
+	sort.Slice(dp.buckets, func(i, j int) bool {
+		return dp.buckets[i].bound < dp.buckets[j].bound
+	})
+
+	var prev uint64
+	for i, b := range dp.buckets {
+		dp.buckets[i].count = b.count - prev
+		prev = b.count
+	}
+}
+
+// otlpDescribe derives the OTLP metric name, unit and kind from a field of a data point.
+// Rates and values not being part of a summary are reported as gauges.
+func otlpDescribe(measurement, field, bucket string) (name, unit string, kind int) {
+	suffix := path.Ext(field)
+	name = measurement + "." + strings.TrimSuffix(field, suffix)
+
+	switch suffix {
+	case suffCounter:
+		// like Prometheus counters they are monotonic: Dec is not supported for the export
+		return name, "", otlpSum
+	case suffGauge:
+		return name, "", otlpGauge
+	case suffMeter:
+		switch bucket {
+		case count:
+			return name, "", otlpSum
+		case mean:
+			return name + ".rate.mean", "", otlpGauge
+		}
+		return name + ".rate." + bucket, "", otlpGauge
+	case suffBuckets:
+		// the cumulative bucket counts, the sum and the count become one histogram data point
+		return name, "", otlpHistogram
+	case suffTimer:
+		unit = "ns"
+	case suffHistogram:
+	default:
+		return measurement + "." + field, "", otlpGauge
+	}
+
+	switch bucket {
+	case m1, m5, m15:
+		return name + ".rate." + bucket, "", otlpGauge
+	case meanrate:
+		return name + ".rate.mean", "", otlpGauge
+	case stddev, variance:
+		return name + "." + bucket, unit, otlpGauge
+	}
+	return name, unit, otlpSummary
+}
+
+// otlpAttributes converts tags to sorted attributes. The bucket tag and the tags
+// of the reporter (which become resource attributes) are left out.
+func otlpAttributes(tags, resource map[string]string) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(tags))
+	for k, v := range tags {
+		if k == "bucket" {
+			continue
+		}
+		if rv, ok := resource[k]; ok && rv == v {
+			continue
+		}
+		attrs = append(attrs, otlpAttribute{key: k, value: v})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].key < attrs[j].key
+	})
+	return attrs
+}
+
+// otlpWithout returns the attributes without the one with the given key.
+func otlpWithout(attrs []otlpAttribute, key string) []otlpAttribute {
+	for i, a := range attrs {
+		if a.key == key {
+			return append(attrs[:i:i], attrs[i+1:]...)
+		}
+	}
+	return attrs
+}
+
+func otlpSeriesKey(attrs []otlpAttribute) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		b.WriteString("," + a.key + "=" + a.value)
+	}
+	return b.String()
+}
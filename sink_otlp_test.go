@@ -0,0 +1,320 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// otlpTestMetrics adds the points of a metric of every kind and the tags of their reporter to the batch.
+func otlpTestMetrics(batch Batch) Batch {
+	rep := NewSinkReporter(&testSink{},
+		Registry(metrics.NewRegistry()),
+		Tags(map[string]string{"host": "srv1"}),
+	)
+
+	NewCounter("requests", WithMeasurement("http"), WithReporter(rep), WithTags(map[string]string{"code": "200"})).Inc(3)
+	NewGauge("queue", WithMeasurement("http"), WithReporter(rep)).Update(7)
+	NewMeter("events", WithMeasurement("http"), WithReporter(rep)).Mark(2)
+	tm := NewTimer("latency", WithMeasurement("http"), WithReporter(rep))
+	tm.Update(10 * time.Millisecond)
+	tm.Update(30 * time.Millisecond)
+	size := NewBucketHistogram("size", []float64{1, 5}, WithMeasurement("http"), WithReporter(rep),
+		WithTags(map[string]string{"code": "200"}))
+	for _, v := range []float64{0.5, 3, 3, 10} {
+		size.Observe(v)
+	}
+
+	r := rep.(*reporter)
+	batch.Points = r.getPoints(batch.Points)
+	batch.Tags = r.tags
+	return batch
+}
+
+func Test_otlpSink_convert(t *testing.T) {
+	s := NewOTLPSink(OTLPConfig{ResourceAttributes: map[string]string{"service.name": "api"}}).(*otlpSink)
+	export := s.convert(otlpTestMetrics(testBatch(0, time.Unix(1577880000, 0))))
+
+	assert.Equal(t, []otlpAttribute{{key: "host", value: "srv1"}, {key: "service.name", value: "api"}}, export.resource)
+
+	byName := make(map[string]*otlpMetric)
+	for _, m := range export.metrics {
+		byName[m.name] = m
+	}
+
+	requests := byName["http.requests"]
+	if assert.NotNil(t, requests) && assert.Len(t, requests.points, 1) {
+		assert.Equal(t, otlpSum, requests.kind)
+		assert.Equal(t, 3.0, requests.points[0].value)
+		assert.Equal(t, []otlpAttribute{{key: "code", value: "200"}}, requests.points[0].attributes)
+	}
+
+	events := byName["http.events"]
+	if assert.NotNil(t, events) && assert.Len(t, events.points, 1) {
+		assert.Equal(t, otlpSum, events.kind)
+		assert.Equal(t, 2.0, events.points[0].value)
+	}
+
+	queue := byName["http.queue"]
+	if assert.NotNil(t, queue) && assert.Len(t, queue.points, 1) {
+		assert.Equal(t, otlpGauge, queue.kind)
+		assert.Equal(t, 7.0, queue.points[0].value)
+		assert.Empty(t, queue.points[0].attributes)
+	}
+
+	latency := byName["http.latency"]
+	if assert.NotNil(t, latency) && assert.Len(t, latency.points, 1) {
+		dp := latency.points[0]
+		assert.Equal(t, otlpSummary, latency.kind)
+		assert.Equal(t, "ns", latency.unit)
+		assert.Equal(t, uint64(2), dp.count)
+		assert.Equal(t, float64(40*time.Millisecond), dp.sum)
+		assert.Equal(t, otlpQuantile{quantile: 0, value: float64(10 * time.Millisecond)}, dp.quantiles[0])
+		assert.Equal(t, otlpQuantile{quantile: 1, value: float64(30 * time.Millisecond)}, dp.quantiles[len(dp.quantiles)-1])
+	}
+
+	size := byName["http.size"]
+	if assert.NotNil(t, size) && assert.Len(t, size.points, 1) {
+		dp := size.points[0]
+		assert.Equal(t, otlpHistogram, size.kind)
+		assert.Equal(t, []otlpAttribute{{key: "code", value: "200"}}, dp.attributes)
+		assert.Equal(t, uint64(4), dp.count)
+		assert.Equal(t, 16.5, dp.sum)
+		assert.Equal(t, []otlpBucket{{bound: 1, count: 1}, {bound: 5, count: 2}, {bound: math.Inf(1), count: 1}}, dp.buckets)
+	}
+
+	assert.NotNil(t, byName["http.latency.rate.m1"])
+	assert.NotNil(t, byName["http.latency.stddev"])
+}
+
+func Test_otlpSink_Write_json(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	s := NewOTLPSink(OTLPConfig{
+		Endpoint: srv.URL + "/v1/metrics",
+		JSON:     true,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	})
+	assert.NoError(t, s.Write(context.Background(), otlpTestMetrics(testBatch(0, time.Unix(1577880000, 0)))))
+
+	var req struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value struct{ StringValue string }
+				}
+			}
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string
+					Sum  *struct {
+						AggregationTemporality int
+						IsMonotonic            bool
+						DataPoints             []struct {
+							TimeUnixNano string
+							AsDouble     float64
+						}
+					}
+					Summary *struct {
+						DataPoints []struct {
+							Count          string
+							QuantileValues []struct{ Quantile, Value float64 }
+						}
+					}
+					Histogram *struct {
+						AggregationTemporality int
+						DataPoints             []struct {
+							Count          string
+							Sum            float64
+							BucketCounts   []string
+							ExplicitBounds []float64
+						}
+					}
+				}
+			}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(<-bodies, &req))
+	if !assert.Len(t, req.ResourceMetrics, 1) || !assert.Len(t, req.ResourceMetrics[0].ScopeMetrics, 1) {
+		return
+	}
+
+	rm := req.ResourceMetrics[0]
+	assert.Equal(t, "host", rm.Resource.Attributes[0].Key)
+	assert.Equal(t, "srv1", rm.Resource.Attributes[0].Value.StringValue)
+
+	var found int
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch m.Name {
+		case "http.requests":
+			found++
+			if assert.NotNil(t, m.Sum) {
+				assert.Equal(t, otlpCumulative, m.Sum.AggregationTemporality)
+				assert.True(t, m.Sum.IsMonotonic)
+				assert.Equal(t, 3.0, m.Sum.DataPoints[0].AsDouble)
+				assert.Equal(t, "1577880000000000000", m.Sum.DataPoints[0].TimeUnixNano)
+			}
+		case "http.events":
+			found++
+			if assert.NotNil(t, m.Sum) {
+				assert.True(t, m.Sum.IsMonotonic)
+			}
+		case "http.latency":
+			found++
+			if assert.NotNil(t, m.Summary) {
+				assert.Equal(t, "2", m.Summary.DataPoints[0].Count)
+				assert.Len(t, m.Summary.DataPoints[0].QuantileValues, 8)
+			}
+		case "http.size":
+			found++
+			if assert.NotNil(t, m.Histogram) && assert.Len(t, m.Histogram.DataPoints, 1) {
+				dp := m.Histogram.DataPoints[0]
+				assert.Equal(t, otlpCumulative, m.Histogram.AggregationTemporality)
+				assert.Equal(t, "4", dp.Count)
+				assert.Equal(t, 16.5, dp.Sum)
+				assert.Equal(t, []string{"1", "2", "1"}, dp.BucketCounts)
+				assert.Equal(t, []float64{1, 5}, dp.ExplicitBounds)
+			}
+		}
+	}
+	assert.Equal(t, 4, found)
+}
+
+func Test_otlpSink_Write_protobuf(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	s := NewOTLPSink(OTLPConfig{Endpoint: srv.URL})
+	assert.NoError(t, s.Write(context.Background(), otlpTestMetrics(testBatch(0, time.Unix(1577880000, 0)))))
+
+	req := decodeProto(t, <-bodies)
+	rm := decodeProto(t, req[1][0])
+	resource := decodeProto(t, rm[1][0])
+	kv := decodeProto(t, resource[1][0])
+	assert.Equal(t, "host", string(kv[1][0]))
+	assert.Equal(t, "srv1", string(decodeProto(t, kv[2][0])[1][0]))
+
+	sm := decodeProto(t, rm[2][0])
+	assert.Equal(t, otlpScope, string(decodeProto(t, sm[1][0])[1][0]))
+
+	metrics := make(map[string]map[int][][]byte)
+	for _, b := range sm[2] {
+		m := decodeProto(t, b)
+		metrics[string(m[1][0])] = m
+	}
+
+	requests := metrics["http.requests"]
+	if assert.NotNil(t, requests) && assert.Len(t, requests[7], 1) {
+		sum := decodeProto(t, requests[7][0])
+		assert.Equal(t, []byte{otlpCumulative}, sum[2][0])
+		assert.Equal(t, []byte{1}, sum[3][0], "counters are monotonic like in Prometheus")
+
+		dp := decodeProto(t, sum[1][0])
+		assert.Equal(t, uint64(1577880000000000000), binary.LittleEndian.Uint64(dp[3][0]))
+		assert.Equal(t, 3.0, math.Float64frombits(binary.LittleEndian.Uint64(dp[4][0])))
+	}
+
+	events := metrics["http.events"]
+	if assert.NotNil(t, events) && assert.Len(t, events[7], 1) {
+		assert.Equal(t, []byte{1}, decodeProto(t, events[7][0])[3][0])
+	}
+
+	latency := metrics["http.latency"]
+	if assert.NotNil(t, latency) && assert.Len(t, latency[11], 1) {
+		assert.Equal(t, "ns", string(latency[3][0]))
+
+		dp := decodeProto(t, decodeProto(t, latency[11][0])[1][0])
+		assert.Equal(t, uint64(2), binary.LittleEndian.Uint64(dp[4][0]))
+		assert.Len(t, dp[6], 8)
+	}
+
+	size := metrics["http.size"]
+	if assert.NotNil(t, size) && assert.Len(t, size[9], 1) {
+		histogram := decodeProto(t, size[9][0])
+		assert.Equal(t, []byte{otlpCumulative}, histogram[2][0])
+
+		dp := decodeProto(t, histogram[1][0])
+		assert.Equal(t, uint64(4), binary.LittleEndian.Uint64(dp[4][0]))
+		assert.Equal(t, 16.5, math.Float64frombits(binary.LittleEndian.Uint64(dp[5][0])))
+		assert.Equal(t, []uint64{1, 2, 1}, decodeFixed64(dp[6][0]))
+		assert.Equal(t, []uint64{math.Float64bits(1), math.Float64bits(5)}, decodeFixed64(dp[7][0]))
+		kv := decodeProto(t, dp[9][0])
+		assert.Equal(t, "code", string(kv[1][0]))
+	}
+}
+
+func Test_otlpSink_Write_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s := NewOTLPSink(OTLPConfig{Endpoint: srv.URL})
+	err := s.Write(context.Background(), testBatch(1, time.Unix(1577880000, 0)))
+	assert.EqualError(t, err, "otlp export failed with status 400: bad request")
+}
+
+// decodeProto decodes the fields of a protobuf message. Varints are returned as their
+// single byte encoding (values < 128), fixed64 values as 8 bytes.
+func decodeProto(t *testing.T, b []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatal("invalid protobuf key")
+		}
+		b = b[n:]
+
+		field := int(key >> 3)
+		switch key & 7 {
+		case protoVarint:
+			_, n = binary.Uvarint(b)
+			fields[field] = append(fields[field], b[:n])
+			b = b[n:]
+		case protoFixed64:
+			fields[field] = append(fields[field], b[:8])
+			b = b[8:]
+		case protoBytes:
+			l, n := binary.Uvarint(b)
+			fields[field] = append(fields[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// decodeFixed64 decodes a packed repeated fixed64 field.
+func decodeFixed64(b []byte) []uint64 {
+	var vs []uint64
+	for ; len(b) >= 8; b = b[8:] {
+		vs = append(vs, binary.LittleEndian.Uint64(b))
+	}
+	return vs
+}
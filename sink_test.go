@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/tehsphinx/concurrent"
+)
+
+type testSink struct {
+	writeCall func(ctx context.Context, batch Batch) error
+}
+
+func (s *testSink) Write(ctx context.Context, batch Batch) error {
+	return s.writeCall(ctx, batch)
+}
+
+// testBatch returns a batch of the given time with n points of the measurement `measure`
+// holding their index as value.
+func testBatch(n int, t time.Time) Batch {
+	batch := Batch{Time: t}
+	for i := 0; i < n; i++ {
+		batch.Points = append(batch.Points, getPoint("measure", map[string]interface{}{"value": i}, nil))
+	}
+	return batch
+}
+
+func TestNewSinkReporter(t *testing.T) {
+	var count = concurrent.NewInt()
+
+	reporter := NewSinkReporter(&testSink{
+		writeCall: func(_ context.Context, batch Batch) error {
+			count.Increase()
+			assert.True(t, batch.Time.Before(time.Now()))
+			assert.True(t, batch.Time.After(time.Now().Add(-time.Second)))
+			assert.Equal(t, 1, len(batch.Points))
+
+			point := batch.Points[0]
+			assert.Equal(t, "testMeasure", point.Measurement)
+			assert.Contains(t, point.Fields, "testCounter.count")
+			assert.Equal(t, map[string]string{"reporterTag": "valRep"}, point.Tags)
+			return nil
+		},
+	},
+		Interval(30*time.Millisecond),
+		Tags(map[string]string{"reporterTag": "valRep"}),
+		Registry(metrics.NewRegistry()),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	metric := NewCounter("testCounter", WithMeasurement("testMeasure"), WithReporter(reporter))
+	for i := 0; i <= 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		metric.Inc(int64(i))
+	}
+
+	assert.NotEmpty(t, count.Get())
+}
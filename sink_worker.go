@@ -0,0 +1,415 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var errSpoolNotEmpty = errors.New("spool not empty")
+
+// sinkWorker writes the batches of a reporter to one sink. Every sink gets its own
+// worker so a slow or failing sink does not delay the others.
+type sinkWorker struct {
+	// dropped counts the points that could not be written. Accessed atomically.
+	dropped int64
+
+	sink         Sink
+	timeout      time.Duration
+	pingInterval time.Duration
+	onError      func(err error)
+	logger       Logger
+	hooks        *hooks
+	stats        *sinkStats
+	index        int
+	pingFailed   bool
+	retry        *retryBuffer
+	spoolConf    *SpoolConfig
+	spool        *spool
+	state        sinkState
+	chunking     chunking
+
+	batches chan Batch
+	flushes chan flushRequest
+	done    chan struct{}
+}
+
+// flushRequest asks the worker to write everything it holds and stop.
+type flushRequest struct {
+	ctx    context.Context
+	batch  Batch
+	result chan error
+}
+
+func newSinkWorker(sink Sink, options ...SinkOption) *sinkWorker {
+	w := &sinkWorker{
+		sink: sink,
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// open opens the spool and the sink.
+func (w *sinkWorker) open() error {
+	if w.spoolConf != nil && w.spool == nil {
+		s, err := openSpool(*w.spoolConf)
+		if err != nil {
+			return fmt.Errorf("unable to open metrics spool: %w", err)
+		}
+		w.spool = s
+	}
+
+	opener, ok := w.sink.(Opener)
+	if !ok {
+		w.state.connected()
+		return nil
+	}
+	if err := opener.Open(); err != nil {
+		w.state.disconnected(err)
+		return err
+	}
+	w.state.connected()
+	return nil
+}
+
+// start starts the worker in its own go routine. It stops once the context is done.
+// Timeout defaults to the given interval, the sink is pinged every 5 seconds by default.
+func (w *sinkWorker) start(ctx context.Context, interval time.Duration) {
+	if w.timeout == 0 {
+		w.timeout = interval
+	}
+	if w.pingInterval == 0 {
+		w.pingInterval = 5 * time.Second
+	}
+	w.batches = make(chan Batch, 1)
+	w.flushes = make(chan flushRequest)
+	w.done = make(chan struct{})
+
+	go w.run(ctx)
+}
+
+func (w *sinkWorker) run(ctx context.Context) {
+	defer close(w.done)
+
+	pingTicker := time.NewTicker(w.pingInterval)
+	defer pingTicker.Stop()
+
+	// retry is only set while batches are waiting in the retry buffer
+	var retry <-chan time.Time
+
+	// replay is only set while the spool is replayed: a batch at a time between new batches
+	var (
+		replay <-chan struct{}
+		ready  = make(chan struct{})
+	)
+	close(ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-w.batches:
+			switch {
+			case w.retry != nil && !w.retry.empty():
+				// keep the order: the batch is written with the buffered ones
+				w.buffer(batch)
+				continue
+			case w.retry == nil && w.spool != nil && !w.spool.empty():
+				// keep the order: the batch is written when the spool is replayed
+				w.spoolBatches("", batch)
+				continue
+			}
+
+			if err := w.write(ctx, batch); err != nil {
+				w.handleError(fmt.Errorf("unable to send metrics: %w", err))
+				if w.retry == nil {
+					// the error has been reported already
+					w.spoolBatches("", batch)
+					continue
+				}
+				w.buffer(batch)
+				retry = time.After(w.retry.backoff())
+			}
+		case <-retry:
+			retry = nil
+			if err := w.flushRetry(ctx); err != nil {
+				w.handleError(fmt.Errorf("unable to send buffered metrics: %w", err))
+				retry = time.After(w.retry.backoff())
+			}
+		case <-replay:
+			if len(w.batches) != 0 {
+				// new batches first: they are spooled behind the replayed ones
+				continue
+			}
+			if !w.replaySpool(ctx) {
+				replay = nil
+			}
+		case <-pingTicker.C:
+			if w.ping() && w.spool != nil && !w.spool.empty() {
+				replay = ready
+			}
+		case req := <-w.flushes:
+			req.result <- w.flush(req.ctx, req.batch)
+			return
+		}
+	}
+}
+
+// shutdown writes the given batch together with all pending and buffered batches and stops the worker.
+func (w *sinkWorker) shutdown(ctx context.Context, batch Batch) error {
+	if w.flushes == nil {
+		// not started: open the spool and the sink first. The batch is still written or spooled
+		// if the sink cannot be opened.
+		if err := w.open(); err != nil {
+			w.handleError(fmt.Errorf("unable to open metrics sink: %w", err))
+		}
+		return w.flush(ctx, batch)
+	}
+
+	req := flushRequest{ctx: ctx, batch: batch, result: make(chan error, 1)}
+	select {
+	case w.flushes <- req:
+	case <-w.done:
+		// stopped already: nothing runs concurrently anymore
+		return w.flush(ctx, batch)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush writes the buffered, the pending and the given batch, oldest first. Once a write fails
+// the remaining batches are spooled if a spool is configured or reported as not delivered.
+func (w *sinkWorker) flush(ctx context.Context, final Batch) error {
+	var batches []Batch
+	if w.retry != nil {
+		batches = w.retry.takeAll()
+	}
+	for pending := true; pending && w.batches != nil; {
+		select {
+		case batch := <-w.batches:
+			batches = append(batches, batch)
+		default:
+			pending = false
+		}
+	}
+	batches = append(batches, final)
+
+	var err error
+	if w.spool != nil && !w.spool.empty() {
+		// keep the order: the batches are written when the spool is replayed
+		err = errSpoolNotEmpty
+	}
+	for err == nil && len(batches) != 0 {
+		if len(batches[0].Points) != 0 {
+			err = w.write(ctx, batches[0])
+			if err != nil {
+				break
+			}
+		}
+		batches = batches[1:]
+	}
+
+	if w.spool != nil {
+		defer w.spool.close()
+		if len(batches) == 0 {
+			return nil
+		}
+		if _, err = w.spool.append(batches...); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("unable to spool metrics: %w", err)
+	}
+
+	var points int
+	for _, batch := range batches {
+		points += len(batch.Points)
+	}
+	if points == 0 {
+		return nil
+	}
+	w.drop(points)
+	return fmt.Errorf("%d points not delivered: %w", points, err)
+}
+
+// buffer adds the batch to the retry buffer. Batches dropped from the buffer are spooled.
+func (w *sinkWorker) buffer(batch Batch) {
+	if dropped := w.retry.push(batch); len(dropped) != 0 {
+		w.spoolBatches("metrics retry buffer is full", dropped...)
+	}
+	w.stats.queue(w.retry)
+	w.state.queue(w.retry)
+}
+
+// flushRetry writes the buffered batches, oldest first, until one fails.
+func (w *sinkWorker) flushRetry(ctx context.Context) error {
+	defer w.state.queue(w.retry)
+	defer w.stats.queue(w.retry)
+
+	if dropped := w.retry.enforceLimits(time.Now()); len(dropped) != 0 {
+		w.spoolBatches("metrics retry buffer expired", dropped...)
+	}
+
+	for !w.retry.empty() {
+		if err := w.write(ctx, w.retry.peek()); err != nil {
+			return err
+		}
+		w.retry.pop()
+	}
+	return nil
+}
+
+// spoolBatches appends the batches to the spool. Without spool the batches are dropped
+// and reported with the given reason.
+func (w *sinkWorker) spoolBatches(reason string, batches ...Batch) {
+	if w.spool == nil {
+		w.dropBatches(reason, batches...)
+		return
+	}
+
+	n, err := w.spool.append(batches...)
+	if err != nil {
+		w.handleError(fmt.Errorf("unable to spool metrics: %w", err))
+		w.dropBatches("metrics could not be spooled", batches...)
+	}
+	if n != 0 {
+		w.drop(n)
+		w.handleError(fmt.Errorf("metrics spool is full: dropped %d points", n))
+	}
+}
+
+// replaySpool writes the next spooled batch to the sink. It returns false once the spool
+// is empty or the write failed.
+func (w *sinkWorker) replaySpool(ctx context.Context) bool {
+	done, err := w.spool.replayNext(ctx, w.write, w.handleError)
+	if err != nil {
+		w.handleError(fmt.Errorf("unable to send spooled metrics: %w", err))
+		return false
+	}
+	return !done
+}
+
+func (w *sinkWorker) dropBatches(reason string, batches ...Batch) {
+	var points int
+	for _, batch := range batches {
+		points += len(batch.Points)
+	}
+	if points == 0 {
+		return
+	}
+
+	w.drop(points)
+	if reason != "" {
+		w.handleError(fmt.Errorf("%s: dropped %d points", reason, points))
+	}
+}
+
+func (w *sinkWorker) drop(points int) {
+	atomic.AddInt64(&w.dropped, int64(points))
+	w.hooks.drop(points)
+	w.stats.drop(points)
+}
+
+// status returns the status of the sink.
+func (w *sinkWorker) status() SinkStatus {
+	status := w.state.get()
+	status.DroppedPoints = w.droppedPoints()
+	return status
+}
+
+// droppedPoints returns the number of points that could not be written.
+func (w *sinkWorker) droppedPoints() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// enqueue hands a batch to the worker without blocking. If the worker is still busy
+// with previous batches the batch is dropped.
+func (w *sinkWorker) enqueue(batch Batch) {
+	select {
+	case w.batches <- batch:
+	default:
+		w.drop(len(batch.Points))
+		w.handleError(fmt.Errorf("metrics sink is busy: dropped %d points", len(batch.Points)))
+	}
+}
+
+// write writes the batch to the sink. Without timeout, i.e. if the worker was never
+// started, the write is only limited by the context.
+func (w *sinkWorker) write(ctx context.Context, batch Batch) error {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := w.chunking.writeChunks(ctx, w.sink, batch)
+	d := time.Since(start)
+
+	w.stats.write(batch, d, err)
+	w.hooks.flush(FlushStats{
+		Sink:     w.index,
+		Points:   len(batch.Points),
+		Duration: d,
+		Err:      err,
+	})
+	if err != nil {
+		w.state.writeFailed(err)
+		w.hooks.writeError(err, len(batch.Points))
+		return err
+	}
+	w.state.written()
+	return nil
+}
+
+// ping checks the connection of the sink and re-opens it if the ping fails.
+// Sinks not implementing Pinger are considered reachable.
+func (w *sinkWorker) ping() bool {
+	pinger, ok := w.sink.(Pinger)
+	if !ok {
+		return true
+	}
+	rtt, err := pinger.Ping()
+	if err != nil {
+		w.pingFailed = true
+		w.state.disconnected(err)
+		w.hooks.pingError(err)
+		w.handleError(fmt.Errorf("got error while sending a ping to the metrics sink: %w", err))
+
+		if err = w.open(); err != nil {
+			w.handleError(fmt.Errorf("unable to reopen metrics sink: %w", err))
+		}
+		return false
+	}
+
+	w.stats.pingRTT(rtt)
+	w.state.connected()
+	if w.pingFailed {
+		w.pingFailed = false
+		w.hooks.reconnect(w.index)
+	}
+	return true
+}
+
+func (w *sinkWorker) handleError(err error) {
+	w.state.error(err)
+	switch {
+	case w.onError != nil:
+		w.onError(err)
+	case w.logger != nil:
+		w.logger.Error("metrics sink error", "error", err)
+	default:
+		log.Println(err)
+	}
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/tehsphinx/concurrent"
+)
+
+func TestReporter_fanOut(t *testing.T) {
+	var (
+		fastCount = concurrent.NewInt()
+		slowCount = concurrent.NewInt()
+		errCount  = concurrent.NewInt()
+	)
+
+	fast := &testSink{
+		writeCall: func(_ context.Context, batch Batch) error {
+			fastCount.Increase()
+			assert.Equal(t, 1, len(batch.Points))
+			return nil
+		},
+	}
+	slow := &testSink{
+		writeCall: func(ctx context.Context, batch Batch) error {
+			slowCount.Increase()
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	reporter := NewSinkReporter(fast,
+		Interval(10*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+		WithSink(slow,
+			SinkTimeout(50*time.Millisecond),
+			OnSinkError(func(err error) {
+				errCount.Increase()
+			}),
+		),
+	)
+	go reporter.Run()
+	defer reporter.Stop()
+
+	NewGauge("testGauge", WithReporter(reporter)).Update(5)
+	time.Sleep(120 * time.Millisecond)
+
+	assert.True(t, fastCount.Get() > slowCount.Get())
+	assert.NotEmpty(t, slowCount.Get())
+	assert.NotEmpty(t, errCount.Get())
+}
+
+func Test_sinkWorker_enqueue(t *testing.T) {
+	var dropped = concurrent.NewInt()
+
+	w := newSinkWorker(&testSink{}, OnSinkError(func(err error) {
+		dropped.Increase()
+	}))
+	w.batches = make(chan Batch, 1)
+
+	w.enqueue(Batch{})
+	w.enqueue(Batch{})
+
+	assert.Equal(t, 1, len(w.batches))
+	assert.Equal(t, 1, dropped.Get())
+	assert.Equal(t, int64(0), w.droppedPoints())
+}
+
+func Test_sinkWorker_retry(t *testing.T) {
+	var (
+		m       sync.Mutex
+		fail    = true
+		written []Batch
+	)
+	sink := &testSink{
+		writeCall: func(_ context.Context, batch Batch) error {
+			m.Lock()
+			defer m.Unlock()
+
+			if fail {
+				return errors.New("unavailable")
+			}
+			written = append(written, batch)
+			return nil
+		},
+	}
+
+	w := newSinkWorker(sink,
+		SinkRetry(RetryConfig{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}),
+		OnSinkError(func(err error) {}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.start(ctx, time.Second)
+
+	start := time.Unix(1577880000, 0)
+	for i := 0; i < 3; i++ {
+		w.enqueue(testBatch(1, start.Add(time.Duration(i)*time.Second)))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	m.Lock()
+	fail = false
+	m.Unlock()
+	time.Sleep(60 * time.Millisecond)
+
+	m.Lock()
+	defer m.Unlock()
+	if !assert.Len(t, written, 3) {
+		return
+	}
+	for i, batch := range written {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Second), batch.Points[0].Time)
+	}
+	assert.Equal(t, int64(0), w.droppedPoints())
+}
@@ -0,0 +1,355 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSpoolSegmentSize is the size at which a new spool segment is started if none is configured.
+	DefaultSpoolSegmentSize = 8 << 20
+
+	spoolExt = ".lp"
+	// spoolOffsetFile holds the replay position in the oldest segment.
+	spoolOffsetFile = "replay.offset"
+)
+
+// SpoolConfig configures a disk-backed spool for batches a sink failed to write. The batches
+// are appended to segment files in line protocol and written to the sink in order once it is
+// reachable again. Segments are kept across restarts. The retention policies of the measurements
+// are stored along with the points as `# CONTEXT-RETENTION-POLICY` lines. The spool is replayed
+// a batch at a time between the writes of new batches. The position of the replay is kept in a
+// `replay.offset` file: points are not written twice if a replay fails or the program restarts.
+type SpoolConfig struct {
+	// Dir is the directory the segments are stored in. It is created if it does not exist.
+	Dir string
+	// MaxBytes caps the disk usage of the spool. The oldest segments are deleted first. 0 means no limit.
+	MaxBytes int64
+	// SegmentSize is the size at which a new segment is started. Defaults to DefaultSpoolSegmentSize.
+	SegmentSize int64
+}
+
+type spoolSegment struct {
+	seq  int
+	path string
+	size int64
+}
+
+// spool stores batches in line protocol segment files.
+type spool struct {
+	conf      SpoolConfig
+	segments  []spoolSegment
+	file      *os.File
+	batchSize int
+
+	// offset is the replay position in the oldest segment, rp the retention policy at it.
+	offset int64
+	rp     string
+}
+
+// openSpool opens the spool directory and picks up the segments of previous runs.
+func openSpool(conf SpoolConfig) (*spool, error) {
+	if conf.SegmentSize <= 0 {
+		conf.SegmentSize = DefaultSpoolSegmentSize
+	}
+	if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{conf: conf, batchSize: DefaultReplayBatchSize}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, spoolExt))
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, spoolSegment{
+			seq:  seq,
+			path: filepath.Join(conf.Dir, name),
+			size: f.Size(),
+		})
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	s.readOffset()
+	return s, nil
+}
+
+// readOffset restores the replay position. It is ignored if it does not refer to the oldest segment.
+func (s *spool) readOffset() {
+	data, err := ioutil.ReadFile(filepath.Join(s.conf.Dir, spoolOffsetFile))
+	if err != nil || s.empty() {
+		return
+	}
+
+	fields := strings.SplitN(strings.TrimSuffix(string(data), "\n"), " ", 3)
+	if len(fields) != 3 {
+		return
+	}
+	seq, err := strconv.Atoi(fields[0])
+	if err != nil || seq != s.segments[0].seq {
+		return
+	}
+	offset, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || offset < 0 || offset > s.segments[0].size {
+		return
+	}
+	s.offset, s.rp = offset, fields[2]
+}
+
+// writeOffset persists the replay position. The file is removed at the start of a segment.
+func (s *spool) writeOffset() error {
+	path := filepath.Join(s.conf.Dir, spoolOffsetFile)
+	if s.offset == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%d %d %s\n", s.segments[0].seq, s.offset, s.rp)), 0644)
+}
+
+func (s *spool) empty() bool {
+	return len(s.segments) == 0
+}
+
+// append writes the batches to the current segment and returns the number of points
+// dropped by deleting the oldest segments to stay within MaxBytes.
+func (s *spool) append(batches ...Batch) (int, error) {
+	var (
+		data []byte
+		rp   string
+	)
+	for _, batch := range batches {
+		for _, p := range batch.Points {
+			if pointRP := batch.RetentionPolicies[p.Measurement]; pointRP != rp {
+				rp = pointRP
+				data = appendRetentionPolicy(data, rp)
+			}
+			data = appendLine(data, p, batch.Time, "ns")
+		}
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if rp != "" {
+		// the next append starts with the default retention policy again
+		data = appendRetentionPolicy(data, "")
+	}
+
+	if s.file == nil || s.segments[len(s.segments)-1].size >= s.conf.SegmentSize {
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.segments[len(s.segments)-1].size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return s.enforceLimit()
+}
+
+// next closes the current segment and starts a new one.
+func (s *spool) next() error {
+	if err := s.close(); err != nil {
+		return err
+	}
+
+	seq := 1
+	if !s.empty() {
+		seq = s.segments[len(s.segments)-1].seq + 1
+	}
+	path := filepath.Join(s.conf.Dir, fmt.Sprintf("%012d%s", seq, spoolExt))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.segments = append(s.segments, spoolSegment{seq: seq, path: path})
+	return nil
+}
+
+func (s *spool) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// enforceLimit deletes the oldest segments until the spool fits into MaxBytes.
+// The segment currently written to is kept. It returns the number of dropped points.
+func (s *spool) enforceLimit() (int, error) {
+	if s.conf.MaxBytes <= 0 {
+		return 0, nil
+	}
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	var dropped int
+	for size > s.conf.MaxBytes && len(s.segments) > 1 {
+		seg := s.segments[0]
+		data, err := ioutil.ReadFile(seg.path)
+		if err != nil {
+			return dropped, err
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return dropped, err
+		}
+
+		dropped += spooledPoints(data[s.offset:])
+		size -= seg.size
+		s.segments = s.segments[1:]
+		s.offset, s.rp = 0, ""
+		if err := s.writeOffset(); err != nil {
+			return dropped, err
+		}
+	}
+	return dropped, nil
+}
+
+// replayNext writes the next batch of the oldest segment to the sink and returns true once the
+// spool is empty. A segment is deleted once all of its points have been written. On a write
+// error the position is kept: the batch is written again the next time. Lines that cannot be
+// parsed, e.g. one torn by a crash while it was appended, are skipped and segments that cannot
+// be read are deleted: both are reported to onError as they would block the spool forever.
+func (s *spool) replayNext(ctx context.Context, write func(ctx context.Context, batch Batch) error, onError func(err error)) (bool, error) {
+	if s.empty() {
+		return true, nil
+	}
+
+	seg := s.segments[0]
+	batch, n, err := s.read(seg, onError)
+	if err != nil {
+		onError(fmt.Errorf("unable to read spool segment %s: %w", seg.path, err))
+		return s.empty(), s.removeSegment()
+	}
+
+	if len(batch.Points) != 0 {
+		if err := write(ctx, batch.Batch); err != nil {
+			return false, err
+		}
+	}
+
+	if s.offset+n < seg.size {
+		s.offset += n
+		s.rp = batch.rp
+		return false, s.writeOffset()
+	}
+	if err := s.removeSegment(); err != nil {
+		return false, err
+	}
+	return s.empty(), nil
+}
+
+// spoolBatch is a batch read from a segment along with the retention policy at its end.
+type spoolBatch struct {
+	Batch
+	rp string
+}
+
+// read reads up to batchSize points of the segment from the replay position. It returns the
+// number of bytes read.
+func (s *spool) read(seg spoolSegment, onError func(err error)) (spoolBatch, int64, error) {
+	batch := spoolBatch{Batch: Batch{Time: time.Now()}, rp: s.rp}
+
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return batch, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return batch, 0, err
+	}
+
+	var (
+		rd     = bufio.NewReader(f)
+		parser = Replayer{Precision: "ns"}
+		n      int64
+	)
+	for len(batch.Points) < s.batchSize {
+		line, err := rd.ReadBytes('\n')
+		n += int64(len(line))
+		if b := bytes.TrimSpace(line); bytes.HasPrefix(b, []byte(contextRetentionPolicy)) {
+			batch.rp = string(bytes.TrimSpace(b[len(contextRetentionPolicy):]))
+		} else if len(b) != 0 && b[0] != '#' {
+			p, parseErr := parser.parse(b)
+			if parseErr != nil {
+				onError(fmt.Errorf("skipped line at offset %d of spool segment %s: %w", s.offset+n-int64(len(line)), seg.path, parseErr))
+			} else {
+				batch.Points = append(batch.Points, p)
+				if batch.rp != "" {
+					if batch.RetentionPolicies == nil {
+						batch.RetentionPolicies = make(map[string]string)
+					}
+					batch.RetentionPolicies[p.Measurement] = batch.rp
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return batch, n, err
+		}
+	}
+	return batch, n, nil
+}
+
+// removeSegment deletes the oldest segment and resets the replay position.
+func (s *spool) removeSegment() error {
+	if len(s.segments) == 1 {
+		// the segment is written to
+		if err := s.close(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.segments[0].path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.segments = s.segments[1:]
+	s.offset, s.rp = 0, ""
+	return s.writeOffset()
+}
+
+func appendRetentionPolicy(b []byte, rp string) []byte {
+	b = append(b, contextRetentionPolicy+" "...)
+	b = append(b, rp...)
+	return append(b, '\n')
+}
+
+// spooledPoints counts the points of a segment, i.e. the lines that are not a retention policy.
+func spooledPoints(data []byte) int {
+	points := bytes.Count(data, []byte{'\n'}) - bytes.Count(data, []byte("\n"+contextRetentionPolicy))
+	if bytes.HasPrefix(data, []byte(contextRetentionPolicy)) {
+		points--
+	}
+	return points
+}
@@ -0,0 +1,405 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/stretchr/testify/assert"
+)
+
+// replayAll replays the spool until it is empty or a write fails.
+func replayAll(s *spool, write func(ctx context.Context, batch Batch) error, onError func(err error)) error {
+	for {
+		done, err := s.replayNext(context.Background(), write, onError)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func Test_spool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := SpoolConfig{Dir: dir, SegmentSize: 40}
+	s, err := openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, s.empty())
+
+	for i := 0; i < 4; i++ {
+		_, err := s.append(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		assert.NoError(t, err)
+	}
+	assert.Len(t, s.segments, 2)
+	assert.NoError(t, s.close())
+
+	// segments survive a restart
+	s, err = openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, s.segments, 2)
+
+	_, err = s.append(testBatch(1, time.Unix(1577880004, 0)))
+	assert.NoError(t, err)
+	assert.Len(t, s.segments, 3)
+
+	var values []int64
+	err = replayAll(s, func(_ context.Context, batch Batch) error {
+		for _, p := range batch.Points {
+			values = append(values, p.Time.Unix()-1577880000)
+		}
+		return nil
+	}, func(err error) {
+		t.Error(err)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, values)
+	assert.True(t, s.empty())
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func Test_spool_replay_tornLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := SpoolConfig{Dir: dir}
+	s, err := openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := s.append(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, s.close())
+
+	// a crash while appending leaves a torn last line
+	f, err := os.OpenFile(s.segments[0].path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("measure value=")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	s, err = openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write errors stop the replay and keep the segment
+	unavailable := errors.New("unavailable")
+	err = replayAll(s, func(context.Context, Batch) error {
+		return unavailable
+	}, func(error) {})
+	assert.True(t, errors.Is(err, unavailable))
+	assert.False(t, s.empty())
+
+	var (
+		values []int64
+		errs   []error
+	)
+	err = replayAll(s, func(_ context.Context, batch Batch) error {
+		for _, p := range batch.Points {
+			values = append(values, p.Time.Unix()-1577880000)
+		}
+		return nil
+	}, func(err error) {
+		errs = append(errs, err)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 1}, values)
+	assert.Len(t, errs, 1)
+	assert.True(t, s.empty())
+
+	// the spool accepts new batches afterwards
+	_, err = s.append(testBatch(1, time.Unix(1577880002, 0)))
+	assert.NoError(t, err)
+	assert.NoError(t, s.close())
+}
+
+func Test_spool_retentionPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := testBatch(1, time.Unix(1577880000, 0))
+	batch.Points = append(batch.Points, getPoint("highres", map[string]interface{}{"value": 1}, nil))
+	batch.RetentionPolicies = map[string]string{"highres": "one_day"}
+	_, err = s.append(batch)
+	assert.NoError(t, err)
+	_, err = s.append(Batch{
+		Points: []client.Point{getPoint("other", map[string]interface{}{"value": 2}, nil)},
+		Time:   time.Unix(1577880000, 0),
+	})
+	assert.NoError(t, err)
+
+	var written []Batch
+	err = replayAll(s, func(_ context.Context, batch Batch) error {
+		written = append(written, batch)
+		return nil
+	}, func(err error) {
+		t.Error(err)
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, written, 1) {
+		assert.Len(t, written[0].Points, 3)
+		assert.Equal(t, map[string]string{"highres": "one_day"}, written[0].RetentionPolicies)
+	}
+	assert.Equal(t, 3, spooledPoints([]byte(contextRetentionPolicy+" rp\nm v=1i\nm v=2i\n"+contextRetentionPolicy+"\nm v=3i\n")))
+}
+
+func Test_spool_replayOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := SpoolConfig{Dir: dir}
+	s, err := openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.batchSize = 1
+	for i := 0; i < 3; i++ {
+		batch := testBatch(1, time.Unix(1577880000+int64(i), 0))
+		batch.RetentionPolicies = map[string]string{"measure": "one_day"}
+		_, err := s.append(batch)
+		assert.NoError(t, err)
+	}
+
+	var (
+		values []int64
+		rps    []string
+		fail   bool
+	)
+	write := func(_ context.Context, batch Batch) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		for _, p := range batch.Points {
+			values = append(values, p.Time.Unix()-1577880000)
+			rps = append(rps, batch.RetentionPolicies[p.Measurement])
+		}
+		return nil
+	}
+
+	done, err := s.replayNext(context.Background(), write, func(err error) { t.Error(err) })
+	assert.NoError(t, err)
+	assert.False(t, done)
+
+	// a failed write keeps the position, so does a restart
+	fail = true
+	_, err = s.replayNext(context.Background(), write, func(err error) { t.Error(err) })
+	assert.Error(t, err)
+	assert.NoError(t, s.close())
+
+	s, err = openSpool(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail = false
+	assert.NoError(t, replayAll(s, write, func(err error) { t.Error(err) }))
+	assert.Equal(t, []int64{0, 1, 2}, values)
+	assert.Equal(t, []string{"one_day", "one_day", "one_day"}, rps)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func Test_spool_maxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := openSpool(SpoolConfig{Dir: dir, SegmentSize: 40, MaxBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	var dropped int
+	for i := 0; i < 6; i++ {
+		n, err := s.append(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		assert.NoError(t, err)
+		dropped += n
+	}
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	assert.True(t, size <= 100)
+	assert.Equal(t, 4, dropped)
+}
+
+func Test_sinkWorker_spool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		fail    = make(chan bool, 1)
+		written = make(chan int64, 10)
+	)
+	fail <- true
+	sink := &testSink{
+		writeCall: func(_ context.Context, batch Batch) error {
+			f := <-fail
+			fail <- f
+			if f {
+				return errors.New("unavailable")
+			}
+			for _, p := range batch.Points {
+				// the points of replayed batches have their own time
+				ts := p.Time
+				if ts.IsZero() {
+					ts = batch.Time
+				}
+				written <- ts.Unix() - 1577880000
+			}
+			return nil
+		},
+	}
+
+	w := newSinkWorker(sink, SinkSpool(SpoolConfig{Dir: dir}), OnSinkError(func(err error) {}))
+	w.pingInterval = 20 * time.Millisecond
+	assert.NoError(t, w.open())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.start(ctx, time.Second)
+
+	for i := 0; i < 3; i++ {
+		w.enqueue(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		time.Sleep(5 * time.Millisecond)
+	}
+	<-fail
+	fail <- false
+
+	for i := int64(0); i < 3; i++ {
+		select {
+		case v := <-written:
+			assert.Equal(t, i, v)
+		case <-time.After(time.Second):
+			t.Fatal("spool was not replayed")
+		}
+	}
+	assert.Equal(t, int64(0), w.droppedPoints())
+}
+
+func Test_sinkWorker_spool_newBatchesDuringReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	written := make(chan int64, 20)
+	sink := &testSink{
+		writeCall: func(_ context.Context, batch Batch) error {
+			time.Sleep(2 * time.Millisecond)
+			for _, p := range batch.Points {
+				// the points of replayed batches have their own time
+				ts := p.Time
+				if ts.IsZero() {
+					ts = batch.Time
+				}
+				written <- ts.Unix() - 1577880000
+			}
+			return nil
+		},
+	}
+
+	w := newSinkWorker(sink, SinkSpool(SpoolConfig{Dir: dir}), OnSinkError(func(err error) { t.Error(err) }))
+	w.pingInterval = 10 * time.Millisecond
+	assert.NoError(t, w.open())
+	w.spool.batchSize = 1
+	for i := 0; i < 10; i++ {
+		_, err := w.spool.append(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		assert.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.start(ctx, time.Second)
+
+	// new batches are spooled while the replay is pending instead of being dropped
+	time.Sleep(15 * time.Millisecond)
+	for i := 10; i < 15; i++ {
+		w.enqueue(testBatch(1, time.Unix(1577880000+int64(i), 0)))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := int64(0); i < 15; i++ {
+		select {
+		case v := <-written:
+			assert.Equal(t, i, v)
+		case <-time.After(time.Second):
+			t.Fatal("spool was not replayed")
+		}
+	}
+	assert.Equal(t, int64(0), w.droppedPoints())
+}
+
+func Test_sinkWorker_shutdown_notStarted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := &testOpener{
+		testSink: testSink{writeCall: func(_ context.Context, _ Batch) error {
+			return errors.New("unavailable")
+		}},
+		openErr: errors.New("connection refused"),
+	}
+	var errs []string
+	w := newSinkWorker(sink, SinkSpool(SpoolConfig{Dir: dir}), OnSinkError(func(err error) {
+		errs = append(errs, err.Error())
+	}))
+
+	assert.NoError(t, w.shutdown(context.Background(), testBatch(1, time.Unix(1577880001, 0))))
+	assert.Equal(t, []string{"unable to open metrics sink: connection refused"}, errs)
+	assert.Equal(t, int64(0), w.droppedPoints())
+
+	s, err := openSpool(SpoolConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spooled []Batch
+	assert.NoError(t, replayAll(s, func(_ context.Context, batch Batch) error {
+		spooled = append(spooled, batch)
+		return nil
+	}, func(err error) { t.Error(err) }))
+	assert.Len(t, spooled, 1)
+}
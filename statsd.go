@@ -0,0 +1,397 @@
+package metrics
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	statsdCounter   = "c"
+	statsdGauge     = "g"
+	statsdTimer     = "ms"
+	statsdHistogram = "h"
+
+	// DefaultStatsDPacketSize keeps the packets below the MTU of an ethernet network.
+	DefaultStatsDPacketSize = 1432
+)
+
+// StatsDConfig holds the settings of a StatsD client.
+type StatsDConfig struct {
+	// Addr is the UDP address of the StatsD server (host:port).
+	Addr string
+	// Prefix is prepended to all metric names.
+	Prefix string
+	// DogStatsD adds the tags of the metrics in the DogStatsD format (`|#tag:value`).
+	DogStatsD bool
+	// SampleRate is the rate (0-1] at which counter, timer and histogram observations are sent.
+	// It is not applied when aggregating. Defaults to 1.
+	SampleRate float64
+	// Aggregate aggregates the observations and only sends them every FlushInterval.
+	// Counters are summed up and gauges send their last value.
+	Aggregate bool
+	// FlushInterval defines how often buffered packets (and aggregates) are sent. Defaults to 1 second.
+	FlushInterval time.Duration
+	// MaxPacketSize limits the size of a packet. Observations are batched into packets up
+	// to this size. Defaults to DefaultStatsDPacketSize.
+	MaxPacketSize int
+}
+
+// StatsDClient sends observations of metrics to StatsD via UDP. Metrics report to it
+// if created with the WithStatsD option or from a reporter with the StatsD option.
+type StatsDClient struct {
+	conf StatsDConfig
+	conn net.Conn
+
+	m          sync.Mutex
+	buf        []byte
+	aggregates map[string]*statsdAggregate
+	rand       *rand.Rand
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type statsdAggregate struct {
+	name   string
+	typ    string
+	tags   string
+	value  float64
+	values []float64
+}
+
+// NewStatsDClient creates a new StatsD client. Close must be called to send the remaining data.
+func NewStatsDClient(conf StatsDConfig) (*StatsDClient, error) {
+	if conf.SampleRate <= 0 || conf.SampleRate > 1 {
+		conf.SampleRate = 1
+	}
+	if conf.FlushInterval == 0 {
+		conf.FlushInterval = time.Second
+	}
+	if conf.MaxPacketSize == 0 {
+		conf.MaxPacketSize = DefaultStatsDPacketSize
+	}
+
+	conn, err := net.Dial("udp", conf.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &StatsDClient{
+		conf:       conf,
+		conn:       conn,
+		buf:        make([]byte, 0, conf.MaxPacketSize),
+		aggregates: make(map[string]*statsdAggregate),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		done:       make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.run()
+	return c, nil
+}
+
+func (c *StatsDClient) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.conf.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = c.Flush()
+		}
+	}
+}
+
+// Flush sends all buffered observations and aggregates.
+func (c *StatsDClient) Flush() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for key, a := range c.aggregates {
+		switch a.typ {
+		case statsdCounter, statsdGauge:
+			c.send(a.name, a.typ, a.value, 1, a.tags)
+		default:
+			for _, v := range a.values {
+				c.send(a.name, a.typ, v, 1, a.tags)
+			}
+		}
+		delete(c.aggregates, key)
+	}
+	return c.flush()
+}
+
+// Close sends the remaining data and closes the connection.
+func (c *StatsDClient) Close() error {
+	close(c.done)
+	c.wg.Wait()
+
+	err := c.Flush()
+	if closeErr := c.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *StatsDClient) observe(name, typ, tags string, value float64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.conf.Aggregate {
+		c.aggregate(name, typ, tags, value)
+		return
+	}
+
+	rate := c.conf.SampleRate
+	if typ == statsdGauge {
+		rate = 1
+	}
+	if rate < 1 && c.rand.Float64() >= rate {
+		return
+	}
+
+	c.send(name, typ, value, rate, tags)
+}
+
+// send writes the value of an observation or aggregate.
+func (c *StatsDClient) send(name, typ string, value, rate float64, tags string) {
+	// a gauge with a sign is interpreted as change: reset it first to send a negative value
+	if typ == statsdGauge && value < 0 {
+		c.write(name, "0", typ, 1, tags)
+	}
+	c.write(name, formatStatsDValue(value), typ, rate, tags)
+}
+
+func (c *StatsDClient) aggregate(name, typ, tags string, value float64) {
+	key := name + "|" + typ + "|" + tags
+	a, ok := c.aggregates[key]
+	if !ok {
+		a = &statsdAggregate{name: name, typ: typ, tags: tags}
+		c.aggregates[key] = a
+	}
+
+	switch typ {
+	case statsdCounter:
+		a.value += value
+	case statsdGauge:
+		a.value = value
+	default:
+		a.values = append(a.values, value)
+	}
+}
+
+// write adds a line to the packet buffer. The buffer is sent first if the line does not fit anymore.
+func (c *StatsDClient) write(name, value, typ string, rate float64, tags string) {
+	line := name + ":" + value + "|" + typ
+	if rate < 1 {
+		line += "|@" + strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	line += tags
+
+	if len(c.buf) != 0 && len(c.buf)+len(line)+1 > c.conf.MaxPacketSize {
+		_ = c.flush()
+	}
+	if len(c.buf) != 0 {
+		c.buf = append(c.buf, '\n')
+	}
+	c.buf = append(c.buf, line...)
+}
+
+func (c *StatsDClient) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	_, err := c.conn.Write(c.buf)
+	c.buf = c.buf[:0]
+	return err
+}
+
+func (c *StatsDClient) name(m *baseMetric) string {
+	name := m.measurement + "." + m.name
+	if c.conf.Prefix != "" {
+		name = c.conf.Prefix + "." + name
+	}
+	return statsdReplacer.Replace(name)
+}
+
+func (c *StatsDClient) tags(tags map[string]string) string {
+	if !c.conf.DogStatsD || len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("|#")
+	for i, k := range keys {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(statsdReplacer.Replace(k) + ":" + statsdReplacer.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_", " ", "_")
+
+func formatStatsDValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// statsdTarget holds the client a metric reports to along with its StatsD name and tags.
+type statsdTarget struct {
+	client *StatsDClient
+	name   string
+	tags   string
+}
+
+func (c *StatsDClient) target(m *baseMetric) *statsdTarget {
+	return &statsdTarget{client: c, name: c.name(m), tags: c.tags(m.tags)}
+}
+
+func (t *statsdTarget) observe(typ string, value float64) {
+	t.client.observe(t.name, typ, t.tags, value)
+}
+
+// statsdSender sends the observations of a metric to StatsD. The target is set once the metric
+// knows its StatsD client, which for metrics created before the default reporter is on binding.
+type statsdSender struct {
+	target atomic.Value // *statsdTarget
+}
+
+// bind sends the observations to the StatsD client of the metric, if it has one.
+func (s *statsdSender) bind(m *baseMetric) {
+	if m.statsd != nil {
+		s.target.Store(m.statsd.target(m))
+	}
+}
+
+func (s *statsdSender) observe(typ string, value float64) {
+	if t, ok := s.target.Load().(*statsdTarget); ok {
+		t.observe(typ, value)
+	}
+}
+
+// statsdBinder is implemented by the StatsD wrappers of the metrics.
+type statsdBinder interface {
+	bind(m *baseMetric)
+}
+
+// bindStatsD binds the StatsD wrapper of a metric, if it has one, see statsdSender.
+func bindStatsD(mtrx interface{}, m *baseMetric) {
+	if b, ok := mtrx.(statsdBinder); ok {
+		b.bind(m)
+	}
+}
+
+// withStatsD reports whether a metric needs a StatsD wrapper: metrics without reporter
+// might get the StatsD client of the default reporter later.
+func withStatsD(m *baseMetric) bool {
+	return m.statsd != nil || m.reporter == nil
+}
+
+// statsdCounterMetric forwards the changes of a counter to StatsD.
+type statsdCounterMetric struct {
+	metrics.Counter
+	statsdSender
+}
+
+// Inc increments the counter and sends the increment to StatsD.
+func (s *statsdCounterMetric) Inc(n int64) {
+	s.Counter.Inc(n)
+	s.observe(statsdCounter, float64(n))
+}
+
+// Dec decrements the counter and sends the decrement to StatsD.
+func (s *statsdCounterMetric) Dec(n int64) {
+	s.Counter.Dec(n)
+	s.observe(statsdCounter, float64(-n))
+}
+
+// statsdGaugeMetric forwards the updates of a gauge to StatsD.
+type statsdGaugeMetric struct {
+	metrics.Gauge
+	statsdSender
+}
+
+// Update updates the gauge and sends the value to StatsD.
+func (s *statsdGaugeMetric) Update(v int64) {
+	s.Gauge.Update(v)
+	s.observe(statsdGauge, float64(v))
+}
+
+// statsdGaugeFloat64Metric forwards the updates of a float64 gauge to StatsD.
+type statsdGaugeFloat64Metric struct {
+	metrics.GaugeFloat64
+	statsdSender
+}
+
+// Update updates the gauge and sends the value to StatsD.
+func (s *statsdGaugeFloat64Metric) Update(v float64) {
+	s.GaugeFloat64.Update(v)
+	s.observe(statsdGauge, v)
+}
+
+// statsdTimerMetric forwards the durations recorded by a timer to StatsD.
+type statsdTimerMetric struct {
+	metrics.Timer
+	statsdSender
+}
+
+// Time records the duration of the execution of the given function.
+func (s *statsdTimerMetric) Time(f func()) {
+	t := time.Now()
+	f()
+	s.Update(time.Since(t))
+}
+
+// Update records the duration and sends it to StatsD.
+func (s *statsdTimerMetric) Update(d time.Duration) {
+	s.Timer.Update(d)
+	s.observe(statsdTimer, float64(d)/float64(time.Millisecond))
+}
+
+// UpdateSince records the duration since the given time and sends it to StatsD.
+func (s *statsdTimerMetric) UpdateSince(t time.Time) {
+	s.Update(time.Since(t))
+}
+
+// statsdMeterMetric forwards the events of a meter to StatsD as counter.
+type statsdMeterMetric struct {
+	metrics.Meter
+	statsdSender
+}
+
+// Mark records the events and sends them to StatsD.
+func (s *statsdMeterMetric) Mark(n int64) {
+	s.Meter.Mark(n)
+	s.observe(statsdCounter, float64(n))
+}
+
+// statsdHistogramMetric forwards the values of a histogram to StatsD.
+type statsdHistogramMetric struct {
+	metrics.Histogram
+	statsdSender
+}
+
+// Update samples the value and sends it to StatsD.
+func (s *statsdHistogramMetric) Update(v int64) {
+	s.Histogram.Update(v)
+	s.observe(statsdHistogram, float64(v))
+}
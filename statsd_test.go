@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func listenUDP(t *testing.T) (*net.UDPConn, <-chan string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			packets <- string(buf[:n])
+		}
+	}()
+	return conn, packets
+}
+
+func receive(t *testing.T, packets <-chan string) string {
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("no packet received")
+	}
+	return ""
+}
+
+func TestStatsDClient_observations(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{
+		Addr:          conn.LocalAddr().String(),
+		Prefix:        "app",
+		DogStatsD:     true,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReporter("", "", Registry(metrics.NewRegistry()), StatsD(c), Tags(map[string]string{"host": "a"}))
+	NewCounter("requests", WithReporter(r), WithMeasurement("http")).Inc(3)
+	NewGauge("queue", WithReporter(r), WithMeasurement("http")).Update(-2)
+	NewTimer("latency", WithReporter(r), WithMeasurement("http")).Update(1500 * time.Microsecond)
+	NewMeter("events", WithReporter(r)).Mark(2)
+	NewHistogram("size", WithReporter(r)).Update(42)
+
+	assert.NoError(t, c.Flush())
+	assert.Equal(t, strings.Join([]string{
+		"app.http.requests:3|c|#host:a",
+		"app.http.queue:0|g|#host:a",
+		"app.http.queue:-2|g|#host:a",
+		"app.http.latency:1.5|ms|#host:a",
+		"app.default.events:2|c|#host:a",
+		"app.default.size:42|h|#host:a",
+	}, "\n"), receive(t, packets))
+	assert.NoError(t, c.Close())
+}
+
+func TestStatsDClient_aggregate(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{
+		Addr:          conn.LocalAddr().String(),
+		Aggregate:     true,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := NewCounter("aggCounter", WithStatsD(c), WithReporter(NewReporter("", "", Registry(metrics.NewRegistry()))))
+	counter.Inc(1)
+	counter.Inc(2)
+	counter.Dec(1)
+
+	assert.NoError(t, c.Close())
+	assert.Equal(t, "default.aggCounter:2|c", receive(t, packets))
+	assert.Equal(t, int64(2), counter.Count())
+}
+
+func TestStatsDClient_aggregateNegativeGauge(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{
+		Addr:          conn.LocalAddr().String(),
+		Aggregate:     true,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauge := NewGauge("aggGauge", WithStatsD(c), WithReporter(NewReporter("", "", Registry(metrics.NewRegistry()))))
+	gauge.Update(3)
+	gauge.Update(-5)
+
+	assert.NoError(t, c.Close())
+	assert.Equal(t, "default.aggGauge:0|g\ndefault.aggGauge:-5|g", receive(t, packets))
+}
+
+func TestStatsDClient_batching(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{
+		Addr:          conn.LocalAddr().String(),
+		MaxPacketSize: 40,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := c.target(&baseMetric{name: "batched", measurement: "m"})
+	for i := 0; i < 3; i++ {
+		target.observe(statsdCounter, 1)
+	}
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, "m.batched:1|c\nm.batched:1|c", receive(t, packets))
+	assert.Equal(t, "m.batched:1|c", receive(t, packets))
+}
+
+func TestStatsDClient_sampleRate(t *testing.T) {
+	conn, packets := listenUDP(t)
+	defer conn.Close()
+
+	c, err := NewStatsDClient(StatsDConfig{
+		Addr:          conn.LocalAddr().String(),
+		SampleRate:    0.5,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := c.target(&baseMetric{name: "sampled", measurement: "m"})
+	for i := 0; i < 100; i++ {
+		target.observe(statsdCounter, 1)
+	}
+	assert.NoError(t, c.Close())
+
+	var lines []string
+	for len(packets) > 0 || len(lines) == 0 {
+		lines = append(lines, strings.Split(receive(t, packets), "\n")...)
+	}
+	assert.True(t, len(lines) < 100)
+	assert.Equal(t, "m.sampled:1|c|@0.5", lines[0])
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status describes the state of a reporter.
+type Status struct {
+	// Running is true while the reporter collects and writes data points.
+	Running bool `json:"running"`
+	// Metrics is the number of metrics registered to the reporter.
+	Metrics int `json:"metrics"`
+	// RejectedSeries counts the distinct new series of vectors exceeding a cardinality limit.
+	// A vector counts each series once, up to 1024 series. Beyond that further series are not counted.
+	RejectedSeries int64 `json:"rejectedSeries"`
+	// Sinks holds the status of the sinks in the order they were added to the reporter.
+	Sinks []SinkStatus `json:"sinks"`
+}
+
+// Healthy returns true if the reporter is running and at least one of its sinks is connected.
+// A reporter with a single unavailable sink out of several still delivers data points, see
+// Degraded for that state.
+func (s Status) Healthy() bool {
+	if !s.Running {
+		return false
+	}
+	if len(s.Sinks) == 0 {
+		return true
+	}
+	for _, sink := range s.Sinks {
+		if sink.Connected {
+			return true
+		}
+	}
+	return false
+}
+
+// Degraded returns true if any of the sinks is not connected.
+func (s Status) Degraded() bool {
+	for _, sink := range s.Sinks {
+		if !sink.Connected {
+			return true
+		}
+	}
+	return false
+}
+
+// SinkStatus describes the state of a sink.
+type SinkStatus struct {
+	// Connected is false after a failed write or ping until a write or ping succeeds.
+	Connected bool `json:"connected"`
+	// LastWrite is the time of the last successful write.
+	LastWrite time.Time `json:"lastWrite"`
+	// LastError is the last error of the sink, empty if there was none.
+	LastError string `json:"lastError,omitempty"`
+	// LastErrorTime is the time the last error occurred.
+	LastErrorTime time.Time `json:"lastErrorTime"`
+	// ConsecutiveFailures counts the writes that failed since the last successful one.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// QueueDepth is the number of data points waiting in the retry buffer.
+	QueueDepth int `json:"queueDepth"`
+	// DroppedPoints is the number of data points that could not be written.
+	DroppedPoints int64 `json:"droppedPoints"`
+}
+
+// sinkState tracks the status of a sink. It is updated by the worker and read by Status.
+type sinkState struct {
+	m      sync.Mutex
+	status SinkStatus
+}
+
+func (s *sinkState) connected() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.status.Connected = true
+}
+
+func (s *sinkState) written() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.status.Connected = true
+	s.status.LastWrite = time.Now()
+	s.status.ConsecutiveFailures = 0
+}
+
+func (s *sinkState) writeFailed(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.status.ConsecutiveFailures++
+	s.setError(err)
+}
+
+func (s *sinkState) disconnected(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.setError(err)
+}
+
+func (s *sinkState) error(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.status.LastError = err.Error()
+	s.status.LastErrorTime = time.Now()
+}
+
+func (s *sinkState) setError(err error) {
+	s.status.Connected = false
+	s.status.LastError = err.Error()
+	s.status.LastErrorTime = time.Now()
+}
+
+func (s *sinkState) queue(b *retryBuffer) {
+	if b == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.status.QueueDepth = b.points
+}
+
+func (s *sinkState) get() SinkStatus {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.status
+}
+
+// statusHandler serves the status of a reporter as JSON.
+type statusHandler struct {
+	reporter StatusReporter
+}
+
+// ServeHTTP writes the status. The response code is 503 if the reporter is not healthy.
+// This is a readiness signal: restarting the process does not bring back a sink.
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	status := h.reporter.Status()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func okSink() *testSink {
+	return &testSink{writeCall: func(_ context.Context, _ Batch) error { return nil }}
+}
+
+func failingSink(fail *int32) *testSink {
+	return &testSink{writeCall: func(_ context.Context, _ Batch) error {
+		if atomic.LoadInt32(fail) == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}}
+}
+
+func TestReporter_Status(t *testing.T) {
+	var fail, failSecond int32
+	rep := NewSinkReporter(failingSink(&fail),
+		Interval(10*time.Millisecond),
+		Registry(metrics.NewRegistry()),
+		WithSink(failingSink(&failSecond)),
+		OnFlush(func(FlushStats) {}),
+		WithLogger(&testLogger{msgs: make(chan string, 100)}),
+	)
+	NewGauge("testGauge", WithReporter(rep)).Update(5)
+	NewCounter("testCounter", WithReporter(rep)).Inc(1)
+
+	status := rep.(StatusReporter).Status()
+	assert.False(t, status.Running)
+	assert.False(t, status.Healthy())
+	assert.Equal(t, 2, status.Metrics)
+	require.Len(t, status.Sinks, 2)
+
+	go rep.Run()
+	defer rep.Stop()
+
+	require.Eventually(t, func() bool {
+		status = rep.(StatusReporter).Status()
+		return status.Running && !status.Sinks[0].LastWrite.IsZero()
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, status.Healthy())
+	assert.False(t, status.Degraded())
+	assert.True(t, status.Sinks[0].Connected)
+	assert.Equal(t, 0, status.Sinks[0].ConsecutiveFailures)
+
+	atomic.StoreInt32(&fail, 1)
+	require.Eventually(t, func() bool {
+		status = rep.(StatusReporter).Status()
+		return status.Sinks[0].ConsecutiveFailures >= 2
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, status.Healthy(), "the second sink still receives the data points")
+	assert.True(t, status.Degraded())
+	assert.False(t, status.Sinks[0].Connected)
+	assert.Contains(t, status.Sinks[0].LastError, "unavailable")
+	assert.True(t, status.Sinks[1].Connected)
+
+	rec := httptest.NewRecorder()
+	rep.(StatusReporter).StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	atomic.StoreInt32(&failSecond, 1)
+	require.Eventually(t, func() bool {
+		status = rep.(StatusReporter).Status()
+		return !status.Sinks[1].Connected
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, status.Healthy())
+
+	rec = httptest.NewRecorder()
+	rep.(StatusReporter).StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var served Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.True(t, served.Running)
+	assert.Equal(t, 2, served.Metrics)
+	assert.False(t, served.Sinks[0].Connected)
+
+	rep.Stop()
+	require.Eventually(t, func() bool {
+		return !rep.(StatusReporter).Status().Running
+	}, time.Second, 5*time.Millisecond)
+}
+
+func Test_statusHandler_healthy(t *testing.T) {
+	rep := NewSinkReporter(okSink(), Registry(metrics.NewRegistry()))
+	go rep.Run()
+	defer rep.Stop()
+
+	require.Eventually(t, func() bool {
+		return rep.(StatusReporter).Status().Running
+	}, time.Second, 5*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	rep.(StatusReporter).StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"running":true`)
+}
@@ -0,0 +1,425 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client"
+	"github.com/rcrowley/go-metrics"
+)
+
+// NewCounterVec creates a new counter vector with the given label keys or retrieves an existing
+// one with the same name. Every combination of label values is reported with its own tags.
+func NewCounterVec(name string, labelKeys []string, options ...Option) *CounterVec {
+	m := newMetric(name, options...)
+	m.suffix = suffCounter
+
+	v := &CounterVec{vec: newVec(m, labelKeys, options, func(options []Option) Metric {
+		return newCounter(name, options...)
+	})}
+	return m.register(v).(*CounterVec)
+}
+
+// NewTimerVec creates a new timer vector with the given label keys or retrieves an existing
+// one with the same name. Every combination of label values is reported with its own tags.
+func NewTimerVec(name string, labelKeys []string, options ...Option) *TimerVec {
+	m := newMetric(name, options...)
+	m.suffix = suffTimer
+
+	v := &TimerVec{vec: newVec(m, labelKeys, options, func(options []Option) Metric {
+		return newTimer(name, options...)
+	})}
+	return m.register(v).(*TimerVec)
+}
+
+// NewHistogramVec creates a new histogram vector with the given label keys or retrieves an existing
+// one with the same name. Every combination of label values is reported with its own tags.
+// The children do not share a histogram given with WithMetric: each gets an empty sample like it.
+func NewHistogramVec(name string, labelKeys []string, options ...Option) *HistogramVec {
+	m := newMetric(name, options...)
+	m.suffix = suffHistogram
+
+	v := &HistogramVec{vec: newVec(m, labelKeys, options, func(options []Option) Metric {
+		return newHistogram(name, options...)
+	})}
+	return m.register(v).(*HistogramVec)
+}
+
+// The vectors are concrete types: called via an interface the label values of With would escape to the heap.
+
+// CounterVec bundles counters with the same name that differ by the values of their labels.
+type CounterVec struct {
+	vec
+}
+
+// With returns the counter with the given label values, in the order of the label keys.
+func (v *CounterVec) With(labelValues ...string) Counter {
+	return v.with(labelValues).(*counter)
+}
+
+// TimerVec bundles timers with the same name that differ by the values of their labels.
+type TimerVec struct {
+	vec
+}
+
+// With returns the timer with the given label values, in the order of the label keys.
+func (v *TimerVec) With(labelValues ...string) Timer {
+	return v.with(labelValues).(*timer)
+}
+
+// HistogramVec bundles histograms with the same name that differ by the values of their labels.
+type HistogramVec struct {
+	vec
+}
+
+// With returns the histogram with the given label values, in the order of the label keys.
+func (v *HistogramVec) With(labelValues ...string) Histogram {
+	return v.with(labelValues).(*histogram)
+}
+
+// vecMetric is implemented by the vectors to access their children.
+type vecMetric interface {
+	each(f func(m Metric))
+	expire(ttl time.Duration, now time.Time)
+	release()
+}
+
+// vec holds the children of a vector by their label values.
+type vec struct {
+	baseMetric
+	healthcheck
+	labelKeys []string
+	options   []Option
+	newChild  func(options []Option) Metric
+
+	m        sync.RWMutex
+	children map[string]Metric
+	ordered  []Metric
+	overflow Metric
+	rejected map[string]struct{}
+	warned   bool
+}
+
+func newVec(m *baseMetric, labelKeys []string, options []Option, newChild func(options []Option) Metric) vec {
+	return vec{
+		baseMetric: *m,
+		labelKeys:  labelKeys,
+		options:    options,
+		newChild:   newChild,
+		children:   make(map[string]Metric),
+	}
+}
+
+// vecKeySize is the size of the buffer the key of the children is built in without allocation.
+const vecKeySize = 256
+
+// maxRejectedKeys limits the rejected series a vector remembers to count each of them once.
+const maxRejectedKeys = 1024
+
+// with returns the child with the given label values and creates it if it does not exist yet.
+// It panics if the number of values does not match the number of label keys.
+func (v *vec) with(labelValues []string) Metric {
+	if len(labelValues) != len(v.labelKeys) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labelKeys), len(labelValues)))
+	}
+
+	var buf [vecKeySize]byte
+	key := appendVecKey(buf[:0], labelValues)
+
+	v.m.RLock()
+	child, ok := v.children[string(key)]
+	if !ok {
+		// a series that was already rejected does not need the write lock while the limit is reached
+		child, ok = v.rejectedChild(string(key))
+	}
+	v.m.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	if child, ok := v.children[string(key)]; ok {
+		return child
+	}
+	if !v.admit(string(key)) {
+		return v.overflowChild()
+	}
+	delete(v.rejected, string(key))
+	child = v.create(labelValues)
+	child.(baser).base().vecKey = string(key)
+	v.children[string(key)] = child
+	v.ordered = append(v.ordered, child)
+	return child
+}
+
+// rejectedChild returns the overflow child if the series has been rejected before and the limit
+// is still reached. Once the vector remembers maxRejectedKeys series, any new series is taken as rejected.
+// The caller must hold at least the read lock.
+func (v *vec) rejectedChild(key string) (Metric, bool) {
+	if v.overflow == nil || !v.full() {
+		return nil, false
+	}
+	if _, ok := v.rejected[key]; !ok && len(v.rejected) < maxRejectedKeys {
+		return nil, false
+	}
+	return v.overflow, true
+}
+
+// full reports whether the cardinality limit of the vector or the reporter is reached.
+func (v *vec) full() bool {
+	if v.maxSeries > 0 && len(v.children) >= v.maxSeries {
+		return true
+	}
+	r, _ := v.reporter.(*reporter)
+	return r != nil && r.maxSeries > 0 && atomic.LoadInt64(&r.series) >= int64(r.maxSeries)
+}
+
+// admit checks the cardinality limits of the vector and the reporter before a new child is created.
+func (v *vec) admit(key string) bool {
+	r, _ := v.reporter.(*reporter)
+	if v.maxSeries > 0 && len(v.children) >= v.maxSeries {
+		v.reject(r, key, v.maxSeries)
+		return false
+	}
+	if r != nil && !r.admitSeries() {
+		v.reject(r, key, r.maxSeries)
+		return false
+	}
+	return true
+}
+
+// reject counts the series once, as long as the vector remembers less than maxRejectedKeys
+// series, and logs a warning the first time a series of the vector is rejected.
+func (v *vec) reject(r *reporter, key string, limit int) {
+	if _, ok := v.rejected[key]; !ok && len(v.rejected) < maxRejectedKeys {
+		if v.rejected == nil {
+			v.rejected = make(map[string]struct{})
+		}
+		v.rejected[key] = struct{}{}
+		if r != nil {
+			atomic.AddInt64(&r.rejectedSeries, 1)
+		}
+	}
+	if v.warned {
+		return
+	}
+	v.warned = true
+
+	msg := "metrics cardinality limit reached: new series are " + v.overflowMode(r).String()
+	if r != nil && r.logger != nil {
+		r.logger.Error(msg, "metric", v.regName(), "limit", limit)
+		return
+	}
+	log.Printf("WARNING: %s: metric=%s limit=%d", msg, v.regName(), limit)
+}
+
+func (v *vec) overflowMode(r *reporter) CardinalityOverflow {
+	if v.maxSeries > 0 || r == nil {
+		return v.overflowBehavior
+	}
+	return r.overflow
+}
+
+// overflowChild returns the child taking the values of the series exceeding the limits.
+// With OverflowReject it is not reported.
+func (v *vec) overflowChild() Metric {
+	if v.overflow != nil {
+		return v.overflow
+	}
+
+	labelValues := make([]string, len(v.labelKeys))
+	for i := range labelValues {
+		labelValues[i] = OverflowValue
+	}
+	v.overflow = v.create(labelValues)
+
+	r, _ := v.reporter.(*reporter)
+	if v.overflowMode(r) == OverflowSeries {
+		v.ordered = append(v.ordered, v.overflow)
+	}
+	return v.overflow
+}
+
+func (v *vec) create(labelValues []string) Metric {
+	labels := make(map[string]string, len(v.labelKeys))
+	for i, key := range v.labelKeys {
+		labels[key] = labelValues[i]
+	}
+
+	options := make([]Option, 0, len(v.options)+4)
+	options = append(options, v.options...)
+	options = append(options, WithReporter(v.reporter), WithTags(composeTags(v.tags, labels)), WithMetric(childMetric(v.metric)), standalone())
+
+	child := v.newChild(options)
+	child.(baser).base().parent = v
+	return child
+}
+
+// childMetric creates the metric of a child like the one given to the vector with WithMetric:
+// the children must not share it. Histograms get an empty sample of the same type and size,
+// nil is returned for any other metric, so the child creates its default metric.
+func childMetric(m interface{}) interface{} {
+	h, ok := m.(metrics.Histogram)
+	if !ok {
+		return nil
+	}
+
+	// the samples of go-metrics do not expose their settings
+	sample := reflect.ValueOf(h.Sample())
+	switch h.Sample().(type) {
+	case *metrics.UniformSample:
+		size := sample.Elem().FieldByName("reservoirSize").Int()
+		return metrics.NewHistogram(metrics.NewUniformSample(int(size)))
+	case *metrics.ExpDecaySample:
+		size := sample.Elem().FieldByName("reservoirSize").Int()
+		alpha := sample.Elem().FieldByName("alpha").Float()
+		return metrics.NewHistogram(metrics.NewExpDecaySample(int(size), alpha))
+	}
+	return nil
+}
+
+// remove removes the child, e.g. when it is closed.
+func (v *vec) remove(child *baseMetric) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	for key, m := range v.children {
+		if isBase(m, child) {
+			v.removeKey(key)
+			return
+		}
+	}
+}
+
+// expire removes the children not updated for ttl and stops their meters. The caller may still
+// hold a child: it is added again with its next update and its meter is restarted.
+func (v *vec) expire(ttl time.Duration, now time.Time) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	var expired map[Metric]struct{}
+	for key, child := range v.children {
+		b := child.(baser).base()
+		if !b.idle(ttl, now) {
+			continue
+		}
+
+		// an update racing with the expiry either sees the state or is seen by the second check
+		if !atomic.CompareAndSwapInt32(&b.state, stateActive, stateExpired) {
+			continue
+		}
+		if !b.idle(ttl, now) {
+			atomic.CompareAndSwapInt32(&b.state, stateExpired, stateActive)
+			continue
+		}
+		if expired == nil {
+			expired = make(map[Metric]struct{})
+		}
+		delete(v.children, key)
+		expired[child] = struct{}{}
+		stopMetric(child)
+	}
+	if len(expired) != 0 {
+		v.removeOrdered(expired)
+	}
+}
+
+// revive adds an expired child again that got updated.
+func (v *vec) revive(child Metric) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	b := child.(baser).base()
+	if !atomic.CompareAndSwapInt32(&b.state, stateExpired, stateActive) {
+		return
+	}
+	restartMetric(child)
+	if _, ok := v.children[b.vecKey]; ok {
+		// With created a new child for the label values in the meantime
+		return
+	}
+	if !v.admit(b.vecKey) {
+		return
+	}
+	v.children[b.vecKey] = child
+	v.ordered = append(v.ordered, child)
+}
+
+// removeKey removes a child.
+func (v *vec) removeKey(key string) {
+	child := v.children[key]
+	delete(v.children, key)
+	v.removeOrdered(map[Metric]struct{}{child: {}})
+}
+
+// removeOrdered removes the children from the list of children and gives back their series.
+// The list is replaced: each iterates over it without lock.
+func (v *vec) removeOrdered(removed map[Metric]struct{}) {
+	ordered := make([]Metric, 0, len(v.ordered))
+	for _, m := range v.ordered {
+		if _, ok := removed[m]; !ok {
+			ordered = append(ordered, m)
+		}
+	}
+	v.ordered = ordered
+
+	r, _ := v.reporter.(*reporter)
+	r.releaseSeries(len(removed))
+}
+
+// release stops all children once the vector is unregistered.
+func (v *vec) release() {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	for _, child := range v.ordered {
+		stopMetric(child)
+	}
+	r, _ := v.reporter.(*reporter)
+	r.releaseSeries(len(v.children))
+
+	v.children = make(map[string]Metric)
+	v.ordered = nil
+	v.overflow = nil
+	v.rejected = nil
+}
+
+func appendVecKey(b []byte, labelValues []string) []byte {
+	for _, value := range labelValues {
+		b = append(b, value...)
+		b = append(b, 0xff)
+	}
+	return b
+}
+
+// each calls f for every child in the order they were created.
+func (v *vec) each(f func(m Metric)) {
+	v.m.RLock()
+	children := v.ordered
+	v.m.RUnlock()
+
+	for _, child := range children {
+		f(child)
+	}
+}
+
+// AddPoints adds the points of all children to be written to the db.
+func (v *vec) AddPoints(pts []client.Point) []client.Point {
+	v.each(func(m Metric) {
+		pts = m.AddPoints(pts)
+	})
+	return pts
+}
+
+// standalone creates a metric without registering it.
+func standalone() Option {
+	return func(s *baseMetric) {
+		s.standalone = true
+	}
+}
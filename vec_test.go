@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCounterVec(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()), Tags(map[string]string{"host": "srv1"}))
+
+	requests := NewCounterVec("requests", []string{"method", "status"},
+		WithReporter(rep), WithMeasurement("http"))
+	requests.With("GET", "200").Inc(2)
+	requests.With("GET", "500").Inc(1)
+	requests.With("GET", "200").Inc(3)
+
+	assert.Equal(t, requests, NewCounterVec("requests", []string{"method", "status"},
+		WithReporter(rep), WithMeasurement("http")))
+	assert.Equal(t, requests.With("GET", "200"), requests.With("GET", "200"))
+
+	pts := rep.(*reporter).getPoints(nil)
+	require.Len(t, pts, 2)
+
+	assert.Equal(t, "http", pts[0].Measurement)
+	assert.Equal(t, map[string]string{"host": "srv1", "method": "GET", "status": "200"}, pts[0].Tags)
+	assert.Equal(t, int64(5), pts[0].Fields["requests.count"])
+	assert.Equal(t, map[string]string{"host": "srv1", "method": "GET", "status": "500"}, pts[1].Tags)
+	assert.Equal(t, int64(1), pts[1].Fields["requests.count"])
+
+	assert.PanicsWithValue(t, "metrics: requests expects 2 label values, got 1", func() {
+		requests.With("GET")
+	})
+}
+
+func TestNewTimerVec(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	latency := NewTimerVec("latency", []string{"route"}, WithReporter(rep))
+	latency.With("/a").Update(time.Second)
+	latency.With("/b").Update(time.Second)
+	latency.With("/b").Update(time.Second)
+
+	assert.Equal(t, int64(1), latency.With("/a").Count())
+	assert.Equal(t, int64(2), latency.With("/b").Count())
+
+	var routes = make(map[string]bool)
+	for _, p := range rep.(*reporter).getPoints(nil) {
+		routes[p.Tags["route"]] = true
+	}
+	assert.Equal(t, map[string]bool{"/a": true, "/b": true}, routes)
+
+	rec := httptest.NewRecorder()
+	rep.(PrometheusExporter).PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `default_latency_seconds_count{route="/a"} 1`)
+	assert.Contains(t, rec.Body.String(), `default_latency_seconds_count{route="/b"} 2`)
+}
+
+func TestNewHistogramVec(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+
+	sizes := NewHistogramVec("size", []string{"kind"}, WithReporter(rep),
+		WithMetric(metrics.NewHistogram(metrics.NewUniformSample(10))))
+	sizes.With("a").Update(5)
+	sizes.With("b").Update(7)
+
+	assert.Equal(t, int64(1), sizes.With("a").Count())
+	assert.Equal(t, int64(5), sizes.With("a").Max())
+	assert.Equal(t, int64(7), sizes.With("b").Max())
+
+	// every child gets a sample like the given one
+	for i := int64(0); i < 20; i++ {
+		sizes.With("a").Update(i)
+	}
+	sample := sizes.With("a").(*histogram).Histogram.Sample()
+	assert.IsType(t, &metrics.UniformSample{}, sample)
+	assert.Equal(t, 10, sample.Size())
+	assert.Equal(t, int64(21), sample.Count())
+}
+
+func Test_vec_With_allocations(t *testing.T) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+	requests := NewCounterVec("requests", []string{"method", "status"}, WithReporter(rep))
+	requests.With("GET", "200")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		requests.With("GET", "200").Inc(1)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func BenchmarkCounterVec_With(b *testing.B) {
+	rep := NewReporter("", "", Registry(metrics.NewRegistry()))
+	requests := NewCounterVec("requests", []string{"method", "status"}, WithReporter(rep))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		requests.With("GET", "200").Inc(1)
+	}
+}